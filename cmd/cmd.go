@@ -19,14 +19,21 @@ func buildTailoutCommand(app *tailout.App) *cobra.Command {
 		},
 	}
 
+	cmd.PersistentFlags().StringVarP(&app.Config.Output, "output", "o", "text", "Output format of the results of status, create, stop and regions (text, json or yaml)")
+
 	cmd.AddCommand(buildCreateCommand(app))
 	cmd.AddCommand(buildDisconnectCommand(app))
 	cmd.AddCommand(buildConnectCommand(app))
+	cmd.AddCommand(buildExtendCommand(app))
+	cmd.AddCommand(buildGCCommand(app))
 	cmd.AddCommand(buildInitCommand(app))
+	cmd.AddCommand(buildReapCommand(app))
+	cmd.AddCommand(buildRegionsCommand(app))
 	cmd.AddCommand(buildStatusCommand(app))
 	cmd.AddCommand(buildStopCommand(app))
 	cmd.AddCommand(buildUiCommand(app))
 	cmd.AddCommand(buildVersionCommand())
+	cmd.AddCommand(buildWatchCommand(app))
 
 	return cmd
 }
@@ -23,9 +23,16 @@ func buildConnectCommand(app *tailout.App) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().BoolVarP(&app.Config.NonInteractive, "non-interactive", "n", false, "Disable interactive prompts")
+	cmd.PersistentFlags().StringVar(&app.Config.Country, "country", "", "Country of the node, as an ISO 3166-1 alpha-2 code or an English name")
+	cmd.PersistentFlags().StringVar(&app.Config.City, "city", "", "City of the node")
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
-	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, change this if you are using Headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.HeadscaleUser, "tailscale-headscale-user", "", "ID of the Headscale user owning the auth keys created for nodes")
 
 	return cmd
 }
@@ -15,13 +15,21 @@ func buildCreateCommand(app *tailout.App) *cobra.Command {
 		Short: "Create an exit node in your tailnet",
 		Long: `Create an exit node in your tailnet.
 
- This command will create an EC2 instance in the targeted region with the following configuration:
- - Amazon Linux 2 AMI
- - t3a.micro instance type
+ This command will create an instance with the configured cloud provider (AWS by default).
+ On AWS, an EC2 instance is created in the targeted region with the following configuration:
+ - Amazon Linux 2023 AMI matching the architecture of the instance type
+ - t3a.micro instance type, unless --instance-type is set
  - Tailscale installed and configured to advertise as an exit node
  - SSH access enabled
  - Tagged with App=tailout
- - The instance will be created as a spot instance in the default VPC`,
+ - The instance will be created as a spot instance in the default VPC, see --market for on-demand fallback
+ - Every availability zone of the region is tried before giving up on missing capacity
+
+ The instance shuts down after the --shutdown duration, 2h by default. With --idle-timeout,
+ it shuts down once no traffic has gone through the node for that long instead, or at the
+ --shutdown duration if it comes first when both are set.
+
+ If the node fails to join the tailnet, its instance is terminated, unless --keep-on-failure is set.`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := app.Create()
@@ -33,14 +41,28 @@ func buildCreateCommand(app *tailout.App) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.AuthKey, "tailscale-auth-key", "", "Tailscale Auth Key to use for operations")
-	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, change this if you are using Headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.LoginServer, "tailscale-login-server", "", "Control server nodes log into, required when using Headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.HeadscaleUser, "tailscale-headscale-user", "", "ID of the Headscale user owning the auth keys created for nodes")
 	cmd.PersistentFlags().BoolVarP(&app.Config.DryRun, "dry-run", "d", false, "Dry run mode (no changes will be made)")
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
 	cmd.PersistentFlags().BoolVarP(&app.Config.NonInteractive, "non-interactive", "n", false, "Disable interactive prompts")
-	cmd.PersistentFlags().StringVarP(&app.Config.Region, "region", "r", "", "Cloud-provider region to use")
+	cmd.PersistentFlags().StringVarP(&app.Config.Region, "region", "r", "", "Cloud-provider region to use, or \"auto\" for the best ranked region")
+	cmd.PersistentFlags().StringVar(&app.Config.Country, "country", "", "Country of the region, as an ISO 3166-1 alpha-2 code or an English name")
+	cmd.PersistentFlags().StringVar(&app.Config.City, "city", "", "City of the region")
+	cmd.PersistentFlags().Float64Var(&app.Config.Regions.PriceWeight, "price-weight", 0, "Weight of the spot price against the latency when ranking regions with --region auto, from 0 (latency only) to 1 (price only)")
 
-	cmd.PersistentFlags().StringVarP(&app.Config.Create.Shutdown, "shutdown", "s", "2h", "Shutdown the instance after the specified duration. Valid time units are \"s\", \"m\", \"h\"")
+	cmd.PersistentFlags().StringVarP(&app.Config.Create.Shutdown, "shutdown", "s", "", "Shutdown the instance after the specified duration, or \"never\" for a persistent node. Valid time units are \"s\", \"m\", \"h\" (default 2h, unless --idle-timeout is set)")
+	cmd.PersistentFlags().StringVar(&app.Config.Create.IdleTimeout, "idle-timeout", "", "Shutdown the instance once it has forwarded no traffic for the specified duration, instead of after 2h when --shutdown is not set")
+	cmd.PersistentFlags().StringVarP(&app.Config.Create.InstanceType, "instance-type", "t", "", "Instance type to use, defaults to the smallest suitable type of the provider")
+	cmd.PersistentFlags().StringSliceVar(&app.Config.Create.FallbackInstanceTypes, "fallback-instance-types", nil, "Instance types to try in order when the instance type has no capacity left (AWS only)")
+	cmd.PersistentFlags().StringVar(&app.Config.Create.Market, "market", "spot", "Purchasing option of the instance: spot, on-demand or spot-then-on-demand (AWS only)")
+	cmd.PersistentFlags().BoolVar(&app.Config.Create.KeepOnFailure, "keep-on-failure", false, "Keep the instance when it fails to join the tailnet, for debugging")
 	cmd.PersistentFlags().BoolVarP(&app.Config.Create.Connect, "connect", "c", false, "Connect to the instance after creation")
 
 	return cmd
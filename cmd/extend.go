@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cterence/tailout/tailout"
+	"github.com/spf13/cobra"
+)
+
+func buildExtendCommand(app *tailout.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "extend <node name> [duration]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "Push back the shutdown of a node",
+		Long: `Push back the shutdown of a node by the given duration, or cancel it with --never.
+
+	The shutdown is rescheduled on the node through Tailscale SSH, and the new expiry is recorded in the tailout:expires-at tag of its instance.
+
+	With the Docker provider, container labels cannot be changed: the new expiry is written inside the container, which removes itself once it is reached, and the tailout:expires-at label keeps the expiry the container was created with. Containers created by older versions of tailout cannot be extended.
+
+	Example : tailout extend tailout-eu-west-3-i-048afd4880f66c596 1h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := app.Extend(args)
+			if err != nil {
+				return fmt.Errorf("failed to extend node: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.HeadscaleUser, "tailscale-headscale-user", "", "ID of the Headscale user owning the auth keys created for nodes")
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
+	cmd.PersistentFlags().BoolVar(&app.Config.Extend.Never, "never", false, "Cancel the shutdown of the node")
+
+	return cmd
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cterence/tailout/tailout"
+	"github.com/spf13/cobra"
+)
+
+func buildGCCommand(app *tailout.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Args:  cobra.NoArgs,
+		Short: "Clean up orphaned instances and dead tailout nodes",
+		Long: `Clean up the resources left behind by tailout.
+
+	Terminates the instances tagged App=tailout, in every region, that have no node in the tailnet, and deletes the tag:tailout nodes that have been offline for a while and whose instance is gone.
+
+	Example : tailout gc --non-interactive`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := app.GC()
+			if err != nil {
+				return fmt.Errorf("failed to clean up: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.HeadscaleUser, "tailscale-headscale-user", "", "ID of the Headscale user owning the auth keys created for nodes")
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
+	cmd.PersistentFlags().BoolVarP(&app.Config.NonInteractive, "non-interactive", "n", false, "Disable interactive prompts")
+	cmd.PersistentFlags().BoolVarP(&app.Config.DryRun, "dry-run", "d", false, "Dry run mode (no changes will be made)")
+
+	return cmd
+}
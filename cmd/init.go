@@ -28,8 +28,11 @@ func buildInitCommand(app *tailout.App) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
-	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, change this if you are using Headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
 	cmd.PersistentFlags().BoolVarP(&app.Config.NonInteractive, "non-interactive", "n", false, "Disable interactive prompts")
 	cmd.PersistentFlags().BoolVarP(&app.Config.DryRun, "dry-run", "d", false, "Dry run mode (no changes will be made)")
 
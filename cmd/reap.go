@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cterence/tailout/tailout"
+	"github.com/spf13/cobra"
+)
+
+func buildReapCommand(app *tailout.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reap",
+		Args:  cobra.NoArgs,
+		Short: "Terminate tailout instances past their expiry",
+		Long: `Terminate the instances created by tailout, in every region, that are past the expiry recorded in their tailout:expires-at tag.
+
+	Nodes shut themselves down when they expire, this catches the ones that failed to, for instance because their bootstrap script failed. It does not ask for confirmation, so it can be run from cron.
+
+	Example : tailout reap`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := app.Reap()
+			if err != nil {
+				return fmt.Errorf("failed to reap instances: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
+	cmd.PersistentFlags().BoolVarP(&app.Config.DryRun, "dry-run", "d", false, "Dry run mode (no changes will be made)")
+
+	return cmd
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cterence/tailout/tailout"
+	"github.com/spf13/cobra"
+)
+
+func buildRegionsCommand(app *tailout.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "regions",
+		Args:  cobra.NoArgs,
+		Short: "Rank the regions of a provider by latency and spot price",
+		Long: `Rank the regions of a provider by latency, spot price or a weighted mix of both.
+
+	The latency is measured to an endpoint of the provider in each region. The spot price of the instance type is included with --price-weight, which weighs it against the latency. The best ranked region is the one picked by tailout create --region auto.
+
+	Example : tailout regions --price-weight 0.5`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := app.Regions()
+			if err != nil {
+				return fmt.Errorf("failed to rank regions: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
+	cmd.PersistentFlags().StringVarP(&app.Config.Create.InstanceType, "instance-type", "t", "", "Instance type to get the spot price of, defaults to the smallest suitable type of the provider")
+	cmd.PersistentFlags().StringVar(&app.Config.Country, "country", "", "Country of the region, as an ISO 3166-1 alpha-2 code or an English name")
+	cmd.PersistentFlags().StringVar(&app.Config.City, "city", "", "City of the region")
+	cmd.PersistentFlags().Float64Var(&app.Config.Regions.PriceWeight, "price-weight", 0, "Weight of the spot price against the latency, from 0 (latency only) to 1 (price only)")
+
+	return cmd
+}
@@ -16,6 +16,8 @@ func buildStatusCommand(app *tailout.App) *cobra.Command {
 
 		This command will show the status of tailout nodes, including the node name and whether it is connected or not.
 
+		When the node in use is about to be reclaimed by its provider, it offers to move to another node, or to a replacement created in the same region.
+
 		Example : tailout status`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := app.Status()
@@ -27,8 +29,15 @@ func buildStatusCommand(app *tailout.App) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
 	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
-	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, change this if you are using Headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.HeadscaleUser, "tailscale-headscale-user", "", "ID of the Headscale user owning the auth keys created for nodes")
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
+	cmd.PersistentFlags().BoolVarP(&app.Config.NonInteractive, "non-interactive", "n", false, "Disable interactive prompts")
+	cmd.PersistentFlags().StringVarP(&app.Config.Create.Shutdown, "shutdown", "s", "2h", "Shutdown the node replacing a draining node after the specified duration")
 
 	return cmd
 }
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cterence/tailout/tailout"
+	"github.com/spf13/cobra"
+)
+
+func buildWatchCommand(app *tailout.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Args:  cobra.NoArgs,
+		Short: "Fail over to another exit node when the current one goes offline",
+		Long: `Watch the exit node this device is connected to, and fail over when it goes offline.
+
+	The current exit node is followed through the local Tailscale daemon. When it goes offline, tailout connects to another online tailout node, or creates a replacement in the same region and connects to it when there is none.
+
+	Example : tailout watch --shutdown 4h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := app.Watch()
+			if err != nil {
+				return fmt.Errorf("failed to watch exit node: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.APIKey, "tailscale-api-key", "", "Tailscale API key used to perform operations on your tailnet")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientID, "tailscale-oauth-client-id", "", "Tailscale OAuth client ID, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.OAuthClientSecret, "tailscale-oauth-client-secret", "", "Tailscale OAuth client secret, used instead of the API key")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.Tailnet, "tailscale-tailnet", "", "Tailscale Tailnet to use for operations")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.LoginServer, "tailscale-login-server", "", "Control server nodes log into, required when using Headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.BaseURL, "tailscale-base-url", "https://api.tailscale.com", "Tailscale base API URL, or the URL of your Headscale server with --tailscale-control-plane headscale")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.ControlPlane, "tailscale-control-plane", "tailscale", "Control plane managing the tailnet (tailscale or headscale)")
+	cmd.PersistentFlags().StringVar(&app.Config.Tailscale.HeadscaleUser, "tailscale-headscale-user", "", "ID of the Headscale user owning the auth keys created for nodes")
+	cmd.PersistentFlags().StringVar(&app.Config.Provider, "provider", "aws", "Cloud provider to use (aws, gce, hetzner, digitalocean, azure, docker)")
+	cmd.PersistentFlags().StringVarP(&app.Config.Region, "region", "r", "", "Region of the replacement node when the region of the offline node cannot be found")
+	cmd.PersistentFlags().StringVarP(&app.Config.Create.Shutdown, "shutdown", "s", "2h", "Shutdown replacement nodes after the specified duration, or \"never\" for persistent nodes")
+	cmd.PersistentFlags().StringVarP(&app.Config.Create.InstanceType, "instance-type", "t", "", "Instance type of replacement nodes, defaults to the smallest suitable type of the provider")
+	cmd.PersistentFlags().StringVar(&app.Config.Create.Market, "market", "spot", "Purchasing option of replacement nodes: spot, on-demand or spot-then-on-demand (AWS only)")
+	cmd.PersistentFlags().BoolVar(&app.Config.Watch.Replace, "replace", true, "Create a replacement node when no other tailout node is online")
+
+	return cmd
+}
@@ -3,50 +3,22 @@ package internal
 import (
 	"context"
 	"fmt"
-	"log"
 	"sort"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/cterence/tailout/tailout/controlplane"
 	"github.com/manifoldco/promptui"
-	tsapi "tailscale.com/client/tailscale/v2"
 )
 
-func GetRegions() ([]string, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
-	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-	}
-	ec2Svc := ec2.NewFromConfig(cfg)
-
-	regions, err := ec2Svc.DescribeRegions(context.TODO(), &ec2.DescribeRegionsInput{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to describe regions: %w", err)
-	}
-
-	regionNames := []string{}
-	for _, region := range regions.Regions {
-		regionNames = append(regionNames, *region.RegionName)
-	}
-
-	return regionNames, nil
-}
-
-// Function that uses promptui to return an AWS region fetched from the aws sdk.
-func SelectRegion() (string, error) {
-	regionNames, err := GetRegions()
-	if err != nil {
-		return "", fmt.Errorf("failed to retrieve regions: %w", err)
-	}
-
+// Function that uses promptui to return one of the given regions.
+func SelectRegion(regionNames []string) (string, error) {
 	sort.Slice(regionNames, func(i, j int) bool {
 		return regionNames[i] < regionNames[j]
 	})
 
 	// Prompt for region with promptui displaying 15 regions at a time, sorted alphabetically and searchable
 	prompt := promptui.Select{
-		Label: "Select AWS region",
+		Label: "Select region",
 		Items: regionNames,
 	}
 
@@ -77,22 +49,23 @@ func PromptYesNo(question string) (bool, error) {
 	return false, nil
 }
 
-func GetActiveNodes(c *tsapi.Client) ([]tsapi.Device, error) {
-	devices, err := c.Devices().List(context.TODO())
+func GetActiveNodes(c controlplane.ControlPlane) ([]controlplane.Node, error) {
+	nodes, err := c.Nodes(context.TODO())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get devices: %w", err)
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
 	}
 
-	tailoutDevices := make([]tsapi.Device, 0)
-	for _, device := range devices {
-		for _, tag := range device.Tags {
+	tailoutNodes := make([]controlplane.Node, 0)
+	for _, node := range nodes {
+		for _, tag := range node.Tags {
 			if tag == "tag:tailout" {
-				if time.Duration(device.LastSeen.Minute()) < 10*time.Minute {
-					tailoutDevices = append(tailoutDevices, device)
+				if node.LastSeen == nil || time.Duration(node.LastSeen.Minute()) < 10*time.Minute {
+					tailoutNodes = append(tailoutNodes, node)
 				}
+				break
 			}
 		}
 	}
 
-	return tailoutDevices, nil
+	return tailoutNodes, nil
 }
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Spinner animates a spinner on a writer, usually stderr so that it does not
+// mix with the results of a command.
+type Spinner struct {
+	w    io.Writer
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartSpinner starts animating a spinner on w until Stop is called.
+func StartSpinner(w io.Writer) *Spinner {
+	s := &Spinner{
+		w:    w,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		// Hide the cursor while spinning.
+		fmt.Fprint(s.w, "\033[?25l")
+		defer fmt.Fprint(s.w, "\b \b\033[?25h")
+
+		for i := 0; ; i++ {
+			fmt.Fprint(s.w, `+\|!/-x`[i%7:i%7+1], "\b")
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+
+	return s
+}
+
+// Stop stops the spinner and restores the cursor. It may be called more than
+// once.
+func (s *Spinner) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
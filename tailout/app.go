@@ -1,15 +1,26 @@
 package tailout
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
 
 	"github.com/cterence/tailout/tailout/config"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+	tsapi "tailscale.com/client/tailscale/v2"
 )
 
 type App struct {
 	Config *config.Config
 
+	// Provider overrides the cloud provider selected by the configuration.
+	Provider provider.Provider
+	// ControlPlane overrides the control plane selected by the configuration.
+	ControlPlane controlplane.ControlPlane
+
 	Out io.Writer
 	Err io.Writer
 }
@@ -23,3 +34,66 @@ func New() (*App, error) {
 	}
 	return app, nil
 }
+
+// provider returns the cloud provider exit nodes are managed with.
+func (app *App) provider() (provider.Provider, error) {
+	if app.Provider != nil {
+		return app.Provider, nil
+	}
+
+	p, err := provider.New(app.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider: %w", err)
+	}
+	return p, nil
+}
+
+// controlPlane returns the control plane nodes are managed with.
+func (app *App) controlPlane() (controlplane.ControlPlane, error) {
+	if app.ControlPlane != nil {
+		return app.ControlPlane, nil
+	}
+
+	client, err := app.tailscaleClient()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := controlplane.New(app.Config.Tailscale, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load control plane: %w", err)
+	}
+	return c, nil
+}
+
+// tailscaleClient returns a Tailscale API client authenticated with the
+// configured OAuth client, or with the API key when there is none. OAuth
+// access tokens are short-lived and refreshed as needed.
+func (app *App) tailscaleClient() (*tsapi.Client, error) {
+	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+	}
+
+	client := &tsapi.Client{
+		APIKey:  app.Config.Tailscale.APIKey,
+		Tailnet: app.Config.Tailscale.Tailnet,
+		BaseURL: baseURL,
+	}
+
+	oauthClientID := app.Config.Tailscale.OAuthClientID
+	oauthClientSecret := app.Config.Tailscale.OAuthClientSecret
+
+	switch {
+	case oauthClientID != "" && oauthClientSecret != "":
+		client.Auth = &tsapi.OAuth{
+			ClientID:     oauthClientID,
+			ClientSecret: oauthClientSecret,
+			Scopes:       []string{"devices:core", "auth_keys", "policy_file"},
+		}
+	case oauthClientID != "" || oauthClientSecret != "":
+		return nil, errors.New("both tailscale OAuth client ID and secret must be set")
+	}
+
+	return client, nil
+}
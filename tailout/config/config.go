@@ -11,33 +11,104 @@ import (
 )
 
 type Config struct {
-	Tailscale      TailscaleConfig `mapstructure:"tailscale"`
-	UI             UIConfig        `mapstructure:"ui"`
-	Region         string          `mapstructure:"region"`
-	Create         CreateConfig    `mapstructure:"create"`
-	NonInteractive bool            `mapstructure:"non_interactive"`
-	DryRun         bool            `mapstructure:"dry_run"`
-	Stop           StopConfig      `mapstructure:"stop"`
+	Tailscale      TailscaleConfig    `mapstructure:"tailscale"`
+	UI             UIConfig           `mapstructure:"ui"`
+	Provider       string             `mapstructure:"provider"`
+	Region         string             `mapstructure:"region"`
+	Country        string             `mapstructure:"country"`
+	City           string             `mapstructure:"city"`
+	AWS            AWSConfig          `mapstructure:"aws"`
+	GCE            GCEConfig          `mapstructure:"gce"`
+	Hetzner        HetznerConfig      `mapstructure:"hetzner"`
+	DigitalOcean   DigitalOceanConfig `mapstructure:"digitalocean"`
+	Azure          AzureConfig        `mapstructure:"azure"`
+	Docker         DockerConfig       `mapstructure:"docker"`
+	Create         CreateConfig       `mapstructure:"create"`
+	NonInteractive bool               `mapstructure:"non_interactive"`
+	DryRun         bool               `mapstructure:"dry_run"`
+	Stop           StopConfig         `mapstructure:"stop"`
+	Extend         ExtendConfig       `mapstructure:"extend"`
+	Watch          WatchConfig        `mapstructure:"watch"`
+	Regions        RegionsConfig      `mapstructure:"regions"`
+	Output         string             `mapstructure:"output"`
 }
 
 type CreateConfig struct {
-	Shutdown string `mapstructure:"shutdown"`
-	Connect  bool   `mapstructure:"connect"`
+	Shutdown              string   `mapstructure:"shutdown"`
+	Connect               bool     `mapstructure:"connect"`
+	InstanceType          string   `mapstructure:"instance_type"`
+	FallbackInstanceTypes []string `mapstructure:"fallback_instance_types"`
+	Market                string   `mapstructure:"market"`
+	KeepOnFailure         bool     `mapstructure:"keep_on_failure"`
+	IdleTimeout           string   `mapstructure:"idle_timeout"`
 }
 type TailscaleConfig struct {
-	BaseURL string `mapstructure:"base_url"`
-	AuthKey string `mapstructure:"auth_key"`
-	APIKey  string `mapstructure:"api_key"`
-	Tailnet string `mapstructure:"tailnet"`
+	BaseURL           string `mapstructure:"base_url"`
+	AuthKey           string `mapstructure:"auth_key"`
+	LoginServer       string `mapstructure:"login_server"`
+	APIKey            string `mapstructure:"api_key"`
+	OAuthClientID     string `mapstructure:"oauth_client_id"`
+	OAuthClientSecret string `mapstructure:"oauth_client_secret"`
+	Tailnet           string `mapstructure:"tailnet"`
+	ControlPlane      string `mapstructure:"control_plane"`
+	HeadscaleUser     string `mapstructure:"headscale_user"`
+}
+
+type AWSConfig struct {
+	SubnetID             string            `mapstructure:"subnet_id"`
+	SecurityGroupIDs     []string          `mapstructure:"security_group_ids"`
+	VPCTags              map[string]string `mapstructure:"vpc_tags"`
+	ManagedSecurityGroup bool              `mapstructure:"managed_security_group"`
+	AuthKeyStore         string            `mapstructure:"auth_key_store"`
+}
+
+type GCEConfig struct {
+	Project string `mapstructure:"project"`
+}
+
+type HetznerConfig struct {
+	Token    string `mapstructure:"token"`
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+type DigitalOceanConfig struct {
+	Token    string `mapstructure:"token"`
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+type AzureConfig struct {
+	SubscriptionID string `mapstructure:"subscription_id"`
+	TenantID       string `mapstructure:"tenant_id"`
+	ClientID       string `mapstructure:"client_id"`
+	ClientSecret   string `mapstructure:"client_secret"`
+	ResourceGroup  string `mapstructure:"resource_group"`
+}
+
+type DockerConfig struct {
+	Binary string `mapstructure:"binary"`
+	Image  string `mapstructure:"image"`
 }
 
 type StopConfig struct {
 	All bool `mapstructure:"all"`
 }
 
+type ExtendConfig struct {
+	Never bool `mapstructure:"never"`
+}
+
+type WatchConfig struct {
+	Replace bool `mapstructure:"replace"`
+}
+
+type RegionsConfig struct {
+	PriceWeight float64 `mapstructure:"price_weight"`
+}
+
 type UIConfig struct {
-	Port    string `mapstructure:"port"`
-	Address string `mapstructure:"address"`
+	Port         string `mapstructure:"port"`
+	Address      string `mapstructure:"address"`
+	ReapInterval string `mapstructure:"reap_interval"`
 }
 
 func (c *Config) Load(flags *pflag.FlagSet, cmdName string) error {
@@ -91,7 +162,11 @@ func (c *Config) Load(flags *pflag.FlagSet, cmdName string) error {
 			return
 		}
 		flagName := strings.ReplaceAll(f.Name, "-", "_")
-		if err := v.BindPFlag(cmdName+"."+f.Name, flags.Lookup(f.Name)); err != nil {
+		key, ok := flagKeys[flagName]
+		if !ok {
+			key = cmdName + "." + f.Name
+		}
+		if err := v.BindPFlag(key, flags.Lookup(f.Name)); err != nil {
 			bindErr = fmt.Errorf("failed to bind flag %s: %w", f.Name, err)
 			return
 		}
@@ -113,9 +188,36 @@ func (c *Config) Load(flags *pflag.FlagSet, cmdName string) error {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	switch c.Output {
+	case "", "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format %q, must be one of text, json or yaml", c.Output)
+	}
+
 	return nil
 }
 
+// flagKeys are the configuration keys of the command specific flags. Flags
+// shared by several commands, such as the create options of watch, are bound
+// to the key of the section they write to so that the configuration file does
+// not override them.
+var flagKeys = map[string]string{
+	"connect":                 "create.connect",
+	"fallback_instance_types": "create.fallback_instance_types",
+	"idle_timeout":            "create.idle_timeout",
+	"instance_type":           "create.instance_type",
+	"keep_on_failure":         "create.keep_on_failure",
+	"market":                  "create.market",
+	"shutdown":                "create.shutdown",
+	"all":                     "stop.all",
+	"never":                   "extend.never",
+	"replace":                 "watch.replace",
+	"price_weight":            "regions.price_weight",
+	"address":                 "ui.address",
+	"port":                    "ui.port",
+	"reap_interval":           "ui.reap_interval",
+}
+
 // bindEnvironmentVariables inspects iface's structure and recursively binds its
 // fields to environment variables. This is a workaround to a limitation of
 // Viper, found here:
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLoadFlagOverridesConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Chdir(dir)
+	file := "create:\n  shutdown: 1h\n  instance_type: t3.micro\nregions:\n  price_weight: 0.2\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd  string
+		args []string
+		want func(c *Config) bool
+	}{
+		{"watch", []string{"--shutdown", "4h"}, func(c *Config) bool { return c.Create.Shutdown == "4h" }},
+		{"status", []string{"--shutdown", "4h"}, func(c *Config) bool { return c.Create.Shutdown == "4h" }},
+		{"regions", []string{"--instance-type", "t4g.nano"}, func(c *Config) bool { return c.Create.InstanceType == "t4g.nano" }},
+		{"create", []string{"--price-weight", "0.8"}, func(c *Config) bool { return c.Regions.PriceWeight == 0.8 }},
+		{"create", []string{}, func(c *Config) bool { return c.Create.Shutdown == "1h" && c.Regions.PriceWeight == 0.2 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			c := &Config{}
+			flags := pflag.NewFlagSet(tt.cmd, pflag.ContinueOnError)
+			flags.StringVar(&c.Create.Shutdown, "shutdown", "2h", "")
+			flags.StringVar(&c.Create.InstanceType, "instance-type", "", "")
+			flags.Float64Var(&c.Regions.PriceWeight, "price-weight", 0, "")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Load(flags, tt.cmd); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want(c) {
+				t.Errorf("unexpected configuration for %s %v: %+v", tt.cmd, tt.args, c)
+			}
+		})
+	}
+}
@@ -5,47 +5,64 @@ import (
 	"errors"
 	"fmt"
 	"net/netip"
-	"net/url"
 	"slices"
 
 	"github.com/cterence/tailout/internal"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
 	"github.com/manifoldco/promptui"
 	"tailscale.com/client/tailscale"
-	tsapi "tailscale.com/client/tailscale/v2"
 	"tailscale.com/ipn"
 	"tailscale.com/tailcfg"
 )
 
 func (app *App) Connect(args []string) error {
-	var nodeConnect string
-
 	nonInteractive := app.Config.NonInteractive
 
-	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
+	control, err := app.controlPlane()
 	if err != nil {
-		return fmt.Errorf("failed to parse base URL: %w", err)
-	}
-
-	apiClient := &tsapi.Client{
-		APIKey:  app.Config.Tailscale.APIKey,
-		Tailnet: app.Config.Tailscale.Tailnet,
-		BaseURL: baseURL,
+		return err
 	}
 
-	var deviceToConnectTo tsapi.Device
+	var deviceToConnectTo controlplane.Node
 
-	tailoutDevices, err := internal.GetActiveNodes(apiClient)
+	tailoutDevices, err := internal.GetActiveNodes(control)
 	if err != nil {
 		return fmt.Errorf("failed to get active nodes: %w", err)
 	}
 
-	if len(args) != 0 {
-		nodeConnect = args[0]
-		i := slices.IndexFunc(tailoutDevices, func(e tsapi.Device) bool {
-			return e.Hostname == nodeConnect
+	// Nodes can be picked by the location of their instance.
+	locationRequested := len(args) == 0 && (app.Config.Country != "" || app.Config.City != "")
+	var cloud provider.Provider
+	var nodeRegions map[string]string
+	if locationRequested {
+		cloud, err = app.provider()
+		if err != nil {
+			return err
+		}
+		tailoutDevices, nodeRegions, err = app.nodesInLocation(cloud, tailoutDevices)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case len(args) != 0:
+		i := slices.IndexFunc(tailoutDevices, func(e controlplane.Node) bool {
+			return e.Hostname == args[0]
 		})
+		if i == -1 {
+			return fmt.Errorf("node %s not found", args[0])
+		}
 		deviceToConnectTo = tailoutDevices[i]
-	} else if !nonInteractive {
+	case locationRequested && len(tailoutDevices) == 1:
+		deviceToConnectTo = tailoutDevices[0]
+	case locationRequested && nonInteractive:
+		deviceToConnectTo, err = app.bestRankedNode(cloud, tailoutDevices, nodeRegions)
+		if err != nil {
+			return err
+		}
+	case !nonInteractive:
 		if len(tailoutDevices) == 0 {
 			return errors.New("no tailout node found in your tailnet")
 		}
@@ -68,8 +85,7 @@ func (app *App) Connect(args []string) error {
 		}
 
 		deviceToConnectTo = tailoutDevices[idx]
-		nodeConnect = deviceToConnectTo.ID
-	} else {
+	default:
 		return errors.New("no node name provided")
 	}
 
@@ -77,7 +93,7 @@ func (app *App) Connect(args []string) error {
 
 	prefs := ipn.NewPrefs()
 
-	prefs.ExitNodeID = tailcfg.StableNodeID(nodeConnect)
+	prefs.ExitNodeID = tailcfg.StableNodeID(deviceToConnectTo.ID)
 	prefs.ExitNodeIP = netip.MustParseAddr(deviceToConnectTo.Addresses[0])
 
 	_, err = localClient.EditPrefs(context.TODO(), &ipn.MaskedPrefs{
@@ -89,6 +105,56 @@ func (app *App) Connect(args []string) error {
 		return fmt.Errorf("failed to run tailscale up command: %w", err)
 	}
 
-	fmt.Println("Connected.")
+	fmt.Fprintln(app.Err, "Connected.")
 	return nil
 }
+
+// nodesInLocation returns the nodes whose instance is in a region of the
+// configured country and city, along with the region of each of them by
+// hostname.
+func (app *App) nodesInLocation(cloud provider.Provider, nodes []controlplane.Node) ([]controlplane.Node, map[string]string, error) {
+	instances, err := cloud.List(context.TODO())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	matching := []controlplane.Node{}
+	regions := map[string]string{}
+	for _, node := range nodes {
+		instance, found := findInstance(instances, node)
+		if !found {
+			continue
+		}
+		location, ok := provider.RegionLocation(cloud.Name(), instance.Region)
+		if ok && location.Matches(app.Config.Country, app.Config.City) {
+			matching = append(matching, node)
+			regions[node.Hostname] = instance.Region
+		}
+	}
+	if len(matching) == 0 {
+		return nil, nil, fmt.Errorf("no tailout node found in %s", app.requestedLocation())
+	}
+
+	return matching, regions, nil
+}
+
+// bestRankedNode returns the node in the best ranked region among the regions
+// of the nodes.
+func (app *App) bestRankedNode(cloud provider.Provider, nodes []controlplane.Node, regions map[string]string) (controlplane.Node, error) {
+	candidates := []string{}
+	for _, node := range nodes {
+		if !slices.Contains(candidates, regions[node.Hostname]) {
+			candidates = append(candidates, regions[node.Hostname])
+		}
+	}
+
+	ranks, err := app.rankRegions(context.TODO(), cloud, candidates, cloud.DefaultInstanceType())
+	if err != nil {
+		return controlplane.Node{}, fmt.Errorf("failed to rank regions: %w", err)
+	}
+
+	i := slices.IndexFunc(nodes, func(node controlplane.Node) bool {
+		return regions[node.Hostname] == ranks[0].Region
+	})
+	return nodes[i], nil
+}
@@ -0,0 +1,35 @@
+package tailout
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+func TestConnectNodeNotFound(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		country string
+		wantErr string
+	}{
+		{"unknown hostname", []string{"tailout-fake-1-i-42"}, "", "node tailout-fake-1-i-42 not found"},
+		{"no node in location", nil, "FR", "no tailout node found in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, _ := newFakeApp()
+			if _, err := cloud.Launch(context.Background(), provider.LaunchInput{Region: "fake-1"}); err != nil {
+				t.Fatal(err)
+			}
+			app.Config.Country = tt.country
+
+			err := app.Connect(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
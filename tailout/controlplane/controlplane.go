@@ -0,0 +1,66 @@
+// Package controlplane abstracts the coordination servers tailout nodes join,
+// Tailscale or a self-hosted Headscale.
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cterence/tailout/tailout/config"
+	tsapi "tailscale.com/client/tailscale/v2"
+)
+
+// Node is a machine of the tailnet.
+type Node struct {
+	ID string
+	// Name is the MagicDNS name of the node, which may differ from its
+	// hostname when the node was renamed or its hostname was already taken.
+	Name      string
+	Hostname  string
+	Addresses []string
+	Tags      []string
+	// LastSeen is nil when the control plane does not report it.
+	LastSeen *time.Time
+	Online   bool
+}
+
+// AuthKey is a key nodes join the tailnet with.
+type AuthKey struct {
+	ID  string
+	Key string
+}
+
+// ControlPlane is implemented by every coordination server tailout can
+// manage nodes with.
+type ControlPlane interface {
+	// Nodes returns every node of the tailnet.
+	Nodes(ctx context.Context) ([]Node, error)
+	// DeleteNode removes a node from the tailnet.
+	DeleteNode(ctx context.Context, id string) error
+	// CreateAuthKey creates a single-use and pre-authorized auth key, valid
+	// for expiry, that tags the nodes using it. Nodes joining with an
+	// ephemeral key are removed from the tailnet once they go offline.
+	CreateAuthKey(ctx context.Context, expiry time.Duration, tags []string, ephemeral bool) (AuthKey, error)
+	// DeleteAuthKey revokes an auth key.
+	DeleteAuthKey(ctx context.Context, key AuthKey) error
+	// Policy returns the access control policy of the tailnet.
+	Policy(ctx context.Context) (*tsapi.ACL, error)
+	// ValidatePolicy checks a policy without applying it.
+	ValidatePolicy(ctx context.Context, policy tsapi.ACL) error
+	// SetPolicy replaces the access control policy of the tailnet.
+	SetPolicy(ctx context.Context, policy tsapi.ACL) error
+}
+
+// New returns the control plane selected by the configuration. client is
+// used by the Tailscale control plane.
+func New(c config.TailscaleConfig, client *tsapi.Client) (ControlPlane, error) {
+	switch c.ControlPlane {
+	case "", "tailscale":
+		return NewTailscale(client), nil
+	case "headscale":
+		return NewHeadscale(c), nil
+	default:
+		return nil, fmt.Errorf("unknown control plane %q", c.ControlPlane)
+	}
+}
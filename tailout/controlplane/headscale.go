@@ -0,0 +1,186 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/internal/rest"
+	"github.com/cterence/tailout/tailout/config"
+	"github.com/tailscale/hujson"
+	tsapi "tailscale.com/client/tailscale/v2"
+)
+
+// Headscale manages nodes through the API of a Headscale server, authenticated
+// with a Headscale API key. Its policy must be stored in the database
+// (policy.mode: database) to be managed by tailout.
+type Headscale struct {
+	api *rest.Client
+	// user is the ID of the Headscale user owning the auth keys.
+	user string
+}
+
+func NewHeadscale(c config.TailscaleConfig) *Headscale {
+	return &Headscale{
+		api: &rest.Client{
+			BaseURL: strings.TrimSuffix(c.BaseURL, "/"),
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + c.APIKey},
+			},
+		},
+		user: c.HeadscaleUser,
+	}
+}
+
+type headscaleNode struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	GivenName   string     `json:"givenName"`
+	IPAddresses []string   `json:"ipAddresses"`
+	ForcedTags  []string   `json:"forcedTags"`
+	ValidTags   []string   `json:"validTags"`
+	LastSeen    *time.Time `json:"lastSeen"`
+	Online      bool       `json:"online"`
+}
+
+func (c *Headscale) Nodes(ctx context.Context) ([]Node, error) {
+	var result struct {
+		Nodes []headscaleNode `json:"nodes"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, "/api/v1/node", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	nodes := make([]Node, 0, len(result.Nodes))
+	for _, node := range result.Nodes {
+		// A tag can be both forced and valid.
+		tags := slices.Concat(node.ForcedTags, node.ValidTags)
+		slices.Sort(tags)
+		nodes = append(nodes, Node{
+			ID:        node.ID,
+			Name:      node.GivenName,
+			Hostname:  node.Name,
+			Addresses: node.IPAddresses,
+			Tags:      slices.Compact(tags),
+			LastSeen:  node.LastSeen,
+			Online:    node.Online,
+		})
+	}
+	return nodes, nil
+}
+
+func (c *Headscale) DeleteNode(ctx context.Context, id string) error {
+	if err := c.api.Do(ctx, http.MethodDelete, "/api/v1/node/"+id, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete node: %w", err)
+	}
+	return nil
+}
+
+func (c *Headscale) CreateAuthKey(ctx context.Context, expiry time.Duration, tags []string, ephemeral bool) (AuthKey, error) {
+	if c.user == "" {
+		return AuthKey{}, errors.New("tailscale.headscale_user must be set to create auth keys")
+	}
+
+	var result struct {
+		PreAuthKey struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		} `json:"preAuthKey"`
+	}
+	err := c.api.Do(ctx, http.MethodPost, "/api/v1/preauthkey", map[string]any{
+		"user":       c.user,
+		"reusable":   false,
+		"ephemeral":  ephemeral,
+		"expiration": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		"aclTags":    tags,
+	}, &result)
+	if err != nil {
+		return AuthKey{}, fmt.Errorf("failed to create pre-auth key: %w", err)
+	}
+
+	return AuthKey{
+		ID:  result.PreAuthKey.ID,
+		Key: result.PreAuthKey.Key,
+	}, nil
+}
+
+// DeleteAuthKey expires the key, as older Headscale versions cannot delete
+// pre-auth keys.
+func (c *Headscale) DeleteAuthKey(ctx context.Context, key AuthKey) error {
+	err := c.api.Do(ctx, http.MethodPost, "/api/v1/preauthkey/expire", map[string]any{
+		"user": c.user,
+		"key":  key.Key,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to expire pre-auth key: %w", err)
+	}
+	return nil
+}
+
+func (c *Headscale) Policy(ctx context.Context) (*tsapi.ACL, error) {
+	var result struct {
+		Policy string `json:"policy"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, "/api/v1/policy", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+
+	acl := &tsapi.ACL{}
+	if strings.TrimSpace(result.Policy) == "" {
+		return acl, nil
+	}
+
+	// Policies are HuJSON documents, with comments and trailing commas.
+	policy, err := hujson.Standardize([]byte(result.Policy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := json.Unmarshal(policy, acl); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	return acl, nil
+}
+
+// ValidatePolicy checks that the tags the auto approvers and SSH rules refer
+// to have owners, which Headscale requires. Headscale cannot validate a policy
+// without applying it, so other errors are only reported by SetPolicy.
+func (c *Headscale) ValidatePolicy(ctx context.Context, policy tsapi.ACL) error {
+	var refs []string
+	if policy.AutoApprovers != nil {
+		refs = append(refs, policy.AutoApprovers.ExitNode...)
+		for _, approvers := range policy.AutoApprovers.Routes {
+			refs = append(refs, approvers...)
+		}
+	}
+	for _, rule := range policy.SSH {
+		refs = append(refs, rule.Source...)
+		refs = append(refs, rule.Destination...)
+	}
+
+	for _, ref := range refs {
+		if _, ok := policy.TagOwners[ref]; strings.HasPrefix(ref, "tag:") && !ok {
+			return fmt.Errorf("tag %s has no owner in the policy", ref)
+		}
+	}
+	return nil
+}
+
+func (c *Headscale) SetPolicy(ctx context.Context, policy tsapi.ACL) error {
+	document, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy: %w", err)
+	}
+
+	err = c.api.Do(ctx, http.MethodPut, "/api/v1/policy", map[string]string{
+		"policy": string(document),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set policy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cterence/tailout/tailout/config"
+	tsapi "tailscale.com/client/tailscale/v2"
+)
+
+// newHeadscaleTestServer returns a Headscale client talking to handler, and
+// the requests it received as "METHOD path".
+func newHeadscaleTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body map[string]any)) (*Headscale, *[]string) {
+	t.Helper()
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("missing API key on %s %s", r.Method, r.URL)
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		body := map[string]any{}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("invalid request body: %v", err)
+			}
+		}
+		handler(w, r, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewHeadscale(config.TailscaleConfig{BaseURL: server.URL + "/", APIKey: "test-key", HeadscaleUser: "1"}), &requests
+}
+
+func TestHeadscaleNodes(t *testing.T) {
+	control, _ := newHeadscaleTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		io.WriteString(w, `{"nodes": [
+			{"id": "1", "name": "tailout-fsn1-42", "givenName": "tailout-fsn1-42", "ipAddresses": ["100.64.0.1"], "forcedTags": ["tag:tailout"], "validTags": ["tag:tailout", "tag:exit"], "lastSeen": "2026-01-02T03:04:05Z", "online": true},
+			{"id": "2", "name": "laptop", "givenName": "laptop-1", "ipAddresses": ["100.64.0.2"]}
+		]}`)
+	})
+
+	nodes, err := control.Nodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastSeen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []Node{
+		{ID: "1", Name: "tailout-fsn1-42", Hostname: "tailout-fsn1-42", Addresses: []string{"100.64.0.1"}, Tags: []string{"tag:exit", "tag:tailout"}, LastSeen: &lastSeen, Online: true},
+		{ID: "2", Name: "laptop-1", Hostname: "laptop", Addresses: []string{"100.64.0.2"}, Tags: []string{}},
+	}
+	if len(nodes) != len(want) {
+		t.Fatalf("got %d nodes, want %d", len(nodes), len(want))
+	}
+	for i := range want {
+		got := nodes[i]
+		if got.ID != want[i].ID || got.Name != want[i].Name || got.Hostname != want[i].Hostname || got.Online != want[i].Online ||
+			!slices.Equal(got.Addresses, want[i].Addresses) || !slices.Equal(got.Tags, want[i].Tags) {
+			t.Errorf("node %d = %+v, want %+v", i, got, want[i])
+		}
+		if (got.LastSeen == nil) != (want[i].LastSeen == nil) || (got.LastSeen != nil && !got.LastSeen.Equal(*want[i].LastSeen)) {
+			t.Errorf("node %d last seen %v, want %v", i, got.LastSeen, want[i].LastSeen)
+		}
+	}
+}
+
+func TestHeadscaleAuthKey(t *testing.T) {
+	control, requests := newHeadscaleTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		switch r.URL.Path {
+		case "/api/v1/preauthkey":
+			if body["user"] != "1" || body["ephemeral"] != false || body["reusable"] != false {
+				t.Errorf("unexpected pre-auth key request %v", body)
+			}
+			io.WriteString(w, `{"preAuthKey": {"id": "7", "key": "hskey-test"}}`)
+		case "/api/v1/preauthkey/expire":
+			if body["key"] != "hskey-test" {
+				t.Errorf("expired key %v, want hskey-test", body["key"])
+			}
+			io.WriteString(w, `{}`)
+		}
+	})
+
+	key, err := control.CreateAuthKey(context.Background(), 10*time.Minute, []string{"tag:tailout"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "7" || key.Key != "hskey-test" {
+		t.Errorf("got key %+v", key)
+	}
+	if err := control.DeleteAuthKey(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"POST /api/v1/preauthkey", "POST /api/v1/preauthkey/expire"}
+	if !slices.Equal(*requests, want) {
+		t.Errorf("requests %v, want %v", *requests, want)
+	}
+}
+
+func TestHeadscalePolicy(t *testing.T) {
+	control, _ := newHeadscaleTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		io.WriteString(w, `{"policy": "{\n  // Exit nodes\n  \"tagOwners\": {\"tag:tailout\": []},\n}"}`)
+	})
+
+	policy, err := control.Policy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := policy.TagOwners["tag:tailout"]; !ok {
+		t.Errorf("tag:tailout missing from tag owners %v", policy.TagOwners)
+	}
+}
+
+func TestHeadscaleValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  tsapi.ACL
+		wantErr bool
+	}{
+		{"empty", tsapi.ACL{}, false},
+		{
+			"owned tags",
+			tsapi.ACL{
+				TagOwners:     map[string][]string{"tag:tailout": {}},
+				AutoApprovers: &tsapi.ACLAutoApprovers{ExitNode: []string{"tag:tailout"}},
+				SSH:           []tsapi.ACLSSH{{Source: []string{"autogroup:member"}, Destination: []string{"tag:tailout"}}},
+			},
+			false,
+		},
+		{
+			"auto approver without owner",
+			tsapi.ACL{AutoApprovers: &tsapi.ACLAutoApprovers{ExitNode: []string{"tag:tailout"}}},
+			true,
+		},
+		{
+			"ssh rule without owner",
+			tsapi.ACL{
+				TagOwners: map[string][]string{"tag:tailout": {}},
+				SSH:       []tsapi.ACLSSH{{Source: []string{"tag:admin"}, Destination: []string{"tag:tailout"}}},
+			},
+			true,
+		},
+	}
+	control := &Headscale{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := control.ValidatePolicy(context.Background(), tt.policy); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
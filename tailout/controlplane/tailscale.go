@@ -0,0 +1,99 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tsapi "tailscale.com/client/tailscale/v2"
+)
+
+// Tailscale manages nodes through the Tailscale API.
+type Tailscale struct {
+	client *tsapi.Client
+}
+
+func NewTailscale(client *tsapi.Client) *Tailscale {
+	return &Tailscale{
+		client: client,
+	}
+}
+
+func (c *Tailscale) Nodes(ctx context.Context) ([]Node, error) {
+	devices, err := c.client.Devices().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	nodes := make([]Node, 0, len(devices))
+	for _, device := range devices {
+		node := Node{
+			ID:        device.ID,
+			Name:      device.Name,
+			Hostname:  device.Hostname,
+			Addresses: device.Addresses,
+			Tags:      device.Tags,
+			Online:    device.ConnectedToControl,
+		}
+		if device.LastSeen != nil {
+			node.LastSeen = &device.LastSeen.Time
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (c *Tailscale) DeleteNode(ctx context.Context, id string) error {
+	if err := c.client.Devices().Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	return nil
+}
+
+func (c *Tailscale) CreateAuthKey(ctx context.Context, expiry time.Duration, tags []string, ephemeral bool) (AuthKey, error) {
+	request := tsapi.CreateKeyRequest{
+		ExpirySeconds: int64(expiry.Seconds()),
+		Description:   "tailout exit node",
+	}
+	request.Capabilities.Devices.Create.Ephemeral = ephemeral
+	request.Capabilities.Devices.Create.Preauthorized = true
+	request.Capabilities.Devices.Create.Tags = tags
+
+	key, err := c.client.Keys().CreateAuthKey(ctx, request)
+	if err != nil {
+		return AuthKey{}, fmt.Errorf("failed to create key: %w", err)
+	}
+	return AuthKey{
+		ID:  key.ID,
+		Key: key.Key,
+	}, nil
+}
+
+func (c *Tailscale) DeleteAuthKey(ctx context.Context, key AuthKey) error {
+	if err := c.client.Keys().Delete(ctx, key.ID); err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	return nil
+}
+
+func (c *Tailscale) Policy(ctx context.Context) (*tsapi.ACL, error) {
+	acl, err := c.client.PolicyFile().Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy file: %w", err)
+	}
+	return acl, nil
+}
+
+func (c *Tailscale) ValidatePolicy(ctx context.Context, policy tsapi.ACL) error {
+	if err := c.client.PolicyFile().Validate(ctx, policy); err != nil {
+		return fmt.Errorf("failed to validate policy file: %w", err)
+	}
+	return nil
+}
+
+func (c *Tailscale) SetPolicy(ctx context.Context, policy tsapi.ACL) error {
+	if err := c.client.PolicyFile().Set(ctx, policy, ""); err != nil {
+		return fmt.Errorf("failed to set policy file: %w", err)
+	}
+	return nil
+}
@@ -2,155 +2,177 @@ package tailout
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"log"
-	"net/url"
-	"sort"
+	"slices"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
-	"github.com/adhocore/chin"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/cterence/tailout/internal"
-	tsapi "tailscale.com/client/tailscale/v2"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
 )
 
-func (app *App) Create() error {
+// createdNode is the result of create.
+type createdNode struct {
+	Hostname     string             `json:"hostname" yaml:"hostname"`
+	Addresses    []string           `json:"addresses" yaml:"addresses"`
+	Region       string             `json:"region" yaml:"region"`
+	Location     *provider.Location `json:"location,omitempty" yaml:"location,omitempty"`
+	InstanceID   string             `json:"instance_id" yaml:"instance_id"`
+	InstanceType string             `json:"instance_type,omitempty" yaml:"instance_type,omitempty"`
+	Market       string             `json:"market,omitempty" yaml:"market,omitempty"`
+	PublicIP     string             `json:"public_ip" yaml:"public_ip"`
+	ExpiresAt    *time.Time         `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Persistent   bool               `json:"persistent" yaml:"persistent"`
+}
+
+// defaultShutdown is how long nodes run when neither a shutdown duration nor
+// an idle timeout is configured.
+const defaultShutdown = "2h"
+
+func (app *App) Create() (err error) {
 	nonInteractive := app.Config.NonInteractive
 	region := app.Config.Region
 	dryRun := app.Config.DryRun
 	connect := app.Config.Create.Connect
 	shutdown := app.Config.Create.Shutdown
+	market := app.Config.Create.Market
 
-	if app.Config.Tailscale.AuthKey == "" {
-		return errors.New("no tailscale auth key found")
-	}
-
-	// TODO: add option for no shutdown
-	duration, err := time.ParseDuration(shutdown)
-	if err != nil {
-		return fmt.Errorf("failed to parse duration: %w", err)
+	var idleTimeout time.Duration
+	if app.Config.Create.IdleTimeout != "" {
+		idleTimeout, err = time.ParseDuration(app.Config.Create.IdleTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to parse idle timeout: %w", err)
+		}
+		if idleTimeout < time.Minute {
+			return errors.New("idle timeout must be at least 1 minute")
+		}
 	}
 
-	durationMinutes := int(duration.Minutes())
-	if durationMinutes < 1 {
-		return errors.New("duration must be at least 1 minute")
+	// Nodes with an idle timeout only shut down once idle, unless a shutdown
+	// duration is also set.
+	if shutdown == "" && idleTimeout == 0 {
+		shutdown = defaultShutdown
 	}
 
-	// Create EC2 service client
+	// Persistent nodes run until they are stopped.
+	persistent := shutdown == provider.ExpiresNever
 
-	if region == "" && !nonInteractive {
-		region, err = internal.SelectRegion()
+	var duration time.Duration
+	if !persistent && shutdown != "" {
+		duration, err = time.ParseDuration(shutdown)
 		if err != nil {
-			return fmt.Errorf("failed to select region: %w", err)
+			return fmt.Errorf("failed to parse duration: %w", err)
+		}
+
+		if duration < time.Minute {
+			return errors.New("duration must be at least 1 minute")
 		}
-	} else if region == "" && nonInteractive {
-		return errors.New("selected non-interactive mode but no region was explicitly specified")
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	if err := provider.ValidateMarket(market); err != nil {
+		return err
+	}
+
+	cloud, err := app.provider()
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-	}
-
-	ec2Svc := ec2.NewFromConfig(cfg)
-
-	// DescribeImages to get the latest Amazon Linux AMI
-	amazonLinuxImages, err := ec2Svc.DescribeImages(context.TODO(), &ec2.DescribeImagesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("name"),
-				Values: []string{"al2023-ami-*"},
-			},
-			{
-				Name:   aws.String("state"),
-				Values: []string{"available"},
-			},
-			{
-				Name:   aws.String("is-public"),
-				Values: []string{"true"},
-			},
-			{
-				Name:   aws.String("architecture"),
-				Values: []string{"x86_64"},
-			},
-		},
-		Owners: []string{"amazon"},
-	})
+		return err
+	}
+
+	control, err := app.controlPlane()
 	if err != nil {
-		return fmt.Errorf("failed to describe Amazon Linux images: %w", err)
+		return err
 	}
 
-	if len(amazonLinuxImages.Images) == 0 {
-		return errors.New("no Amazon Linux images found")
+	// Define the instance details
+	instanceType := app.Config.Create.InstanceType
+	if instanceType == "" {
+		instanceType = cloud.DefaultInstanceType()
 	}
 
-	sort.Slice(amazonLinuxImages.Images, func(i, j int) bool {
-		return *amazonLinuxImages.Images[i].CreationDate > *amazonLinuxImages.Images[j].CreationDate
-	})
+	if region == "" || region == autoRegion || app.Config.Country != "" || app.Config.City != "" {
+		regions, err := app.candidateRegions(context.TODO(), cloud)
+		if err != nil {
+			return err
+		}
 
-	// Get the latest Amazon Linux AMI ID
-	latestAMI := amazonLinuxImages.Images[0]
-	imageID := *latestAMI.ImageId
+		switch {
+		case region == autoRegion:
+			fmt.Fprintln(app.Err, "Measuring regions...")
+			ranks, err := app.rankRegions(context.TODO(), cloud, regions, instanceType)
+			if err != nil {
+				return fmt.Errorf("failed to rank regions: %w", err)
+			}
+			region = ranks[0].Region
+			fmt.Fprintf(app.Err, "Selected region %s (%s).\n", region, ranks[0].describe())
+		case region != "":
+			if !slices.Contains(regions, region) {
+				return fmt.Errorf("region %s is not in %s", region, app.requestedLocation())
+			}
+		case len(regions) == 1:
+			region = regions[0]
+		case nonInteractive:
+			return errors.New("selected non-interactive mode but no region was explicitly specified, use --region auto to pick the best ranked one")
+		default:
+			region, err = internal.SelectRegion(regions)
+			if err != nil {
+				return fmt.Errorf("failed to select region: %w", err)
+			}
+		}
+	}
 
-	// Define the instance details
-	// TODO: add option for instance type
-	instanceType := "t3a.micro"
-	userDataScript := `#!/bin/bash
-# Allow ip forwarding
-echo 'net.ipv4.ip_forward = 1' | sudo tee -a /etc/sysctl.conf
-echo 'net.ipv6.conf.all.forwarding = 1' | sudo tee -a /etc/sysctl.conf
-sudo sysctl -p /etc/sysctl.conf
+	image, err := cloud.FindImage(context.TODO(), region, instanceType)
+	if err != nil {
+		return fmt.Errorf("failed to find image: %w", err)
+	}
 
-TOKEN=$(curl -sSL -X PUT "http://169.254.169.254/latest/api/token" -H "X-aws-ec2-metadata-token-ttl-seconds: 30")
-INSTANCE_ID=$(curl -sSL -H "X-aws-ec2-metadata-token: ${TOKEN}" http://169.254.169.254/latest/meta-data/instance-id)
+	authKeyDescription := "single-use ephemeral key created for this node"
+	if persistent {
+		authKeyDescription = "single-use key created for this node"
+	}
+	if app.Config.Tailscale.AuthKey != "" {
+		authKeyDescription = "configured auth key"
+	}
 
-curl -fsSL https://tailscale.com/install.sh | sh
-sudo tailscale up --auth-key=` + app.Config.Tailscale.AuthKey + ` --hostname=tailout-` + region + `-${INSTANCE_ID} --advertise-exit-node --ssh
-sudo echo "sudo shutdown" | at now + ` + strconv.Itoa(durationMinutes) + ` minutes`
-
-	// Encode the string in base64
-	userDataScriptBase64 := base64.StdEncoding.EncodeToString([]byte(userDataScript))
-
-	// Create instance input parameters
-	runInput := &ec2.RunInstancesInput{
-		ImageId:      aws.String(imageID),
-		InstanceType: types.InstanceTypeT3aMicro,
-		MinCount:     aws.Int32(1),
-		MaxCount:     aws.Int32(1),
-		UserData:     aws.String(userDataScriptBase64),
-		DryRun:       aws.Bool(dryRun),
-		InstanceMarketOptions: &types.InstanceMarketOptionsRequest{
-			MarketType: types.MarketTypeSpot,
-			SpotOptions: &types.SpotMarketOptions{
-				InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
-			},
-		},
-	}
-
-	stsSvc := sts.NewFromConfig(cfg)
-
-	identity, err := stsSvc.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	account, err := cloud.Account(context.TODO())
 	if err != nil {
-		return fmt.Errorf("failed to get account ID: %w", err)
+		return fmt.Errorf("failed to get account: %w", err)
 	}
 
-	fmt.Printf(`Creating tailout node in AWS with the following parameters:
-- AWS Account ID: %s
-- AMI ID: %s
+	location, hasLocation := provider.RegionLocation(cloud.Name(), region)
+	regionDescription := region
+	if hasLocation {
+		regionDescription += " (" + location.String() + ")"
+	}
+
+	fmt.Fprintf(app.Err, `Creating tailout node with the following parameters:
+- Provider: %s
+- Account: %s
+- Image: %s
 - Instance Type: %s
+- Market: %s
 - Region: %s
-- Auto shutdown after: %s
 - Connect after instance up: %v
-- Network: default VPC / Subnet / Security group of the region
-`, *identity.Account, imageID, instanceType, region, shutdown, connect)
+- Auth key: %s
+`, cloud.Name(), account, image.ID, instanceType, market, regionDescription, connect, authKeyDescription)
+
+	if shutdown != "" {
+		fmt.Fprintf(app.Err, "- Auto shutdown after: %s\n", shutdown)
+	}
+	if idleTimeout > 0 {
+		fmt.Fprintf(app.Err, "- Auto shutdown when idle for: %s\n", idleTimeout)
+	}
+
+	if biller, ok := cloud.(provider.BillingIncrementer); ok && duration > 0 {
+		increment := biller.BillingIncrement()
+		billed := ((duration + increment - 1) / increment) * increment
+		fmt.Fprintf(app.Err, "- Billed duration: %s (%s bills every started %s)\n", billed, cloud.Name(), increment)
+		if billed != duration {
+			fmt.Fprintf(app.Err, "  Consider a shutdown duration of %s to use all the billed time.\n", billed)
+		}
+	}
 
 	if !nonInteractive {
 		result, err := internal.PromptYesNo("Do you want to create this instance?")
@@ -161,90 +183,181 @@ sudo echo "sudo shutdown" | at now + ` + strconv.Itoa(durationMinutes) + ` minut
 		if !result {
 			return nil
 		}
+
+		if persistent {
+			result, err := internal.PromptYesNo("This instance will never shut down on its own and will be billed until it is stopped. Do you want to continue?")
+			if err != nil {
+				return fmt.Errorf("failed to prompt for confirmation: %w", err)
+			}
+
+			if !result {
+				return nil
+			}
+		}
 	}
 
-	// Run the EC2 instance
-	runResult, err := ec2Svc.RunInstances(context.TODO(), runInput)
-	if err != nil {
-		return fmt.Errorf("failed to create EC2 instance: %w", err)
-	}
-
-	if len(runResult.Instances) == 0 {
-		fmt.Println("No instances created.")
-		return nil
-	}
-
-	createdInstance := runResult.Instances[0]
-	fmt.Println("EC2 instance created successfully:", *createdInstance.InstanceId)
-	nodeName := fmt.Sprintf("tailout-%s-%s", region, *createdInstance.InstanceId)
-	fmt.Println("Instance will be named", nodeName)
-	// Create tags for the instance
-	tags := []types.Tag{
-		{
-			Key:   aws.String("App"),
-			Value: aws.String("tailout"),
-		},
-		{
-			Key:   aws.String("Name"),
-			Value: aws.String(nodeName),
-		},
-	}
-
-	// Add the tags to the instance
-	_, err = ec2Svc.CreateTags(context.TODO(), &ec2.CreateTagsInput{
-		Resources: []string{*createdInstance.InstanceId},
-		Tags:      tags,
+	// Nodes join the tailnet with a single-use key minted for them, unless an
+	// auth key is configured. The key is ephemeral unless the node is
+	// persistent, so that it stays in the tailnet while it is offline.
+	authKey := app.Config.Tailscale.AuthKey
+	if authKey == "" && !dryRun {
+		// The key is valid long enough for a node to boot and join.
+		key, err := control.CreateAuthKey(context.TODO(), 10*time.Minute, []string{"tag:tailout"}, !persistent)
+		if err != nil {
+			return fmt.Errorf("failed to create auth key: %w", err)
+		}
+		authKey = key.Key
+
+		// The key is useless once the node has joined, or failed to.
+		defer func() {
+			if err := control.DeleteAuthKey(context.TODO(), key); err != nil {
+				fmt.Fprintln(app.Err, "Failed to revoke auth key", key.ID+":", err)
+			}
+		}()
+	}
+
+	authKeyScript := "AUTH_KEY=" + authKey
+	if storer, ok := cloud.(provider.SecretStorer); ok && storer.StoresSecrets() && !dryRun {
+		secret, err := storer.StoreSecret(context.TODO(), region, authKey)
+		if err != nil {
+			return fmt.Errorf("failed to store auth key: %w", err)
+		}
+		authKeyScript = secret.Script
+
+		// The node only needs the secret until it has joined the tailnet.
+		defer func() {
+			if err := storer.DeleteSecret(context.TODO(), region, secret); err != nil {
+				fmt.Fprintln(app.Err, "Failed to delete auth key secret", secret.ID+":", err)
+			}
+		}()
+	}
+
+	tailscaleArgs := []string{"--advertise-exit-node", "--ssh"}
+	// Nodes log into the Headscale server tailout manages them with, unless
+	// another login server is configured.
+	loginServer := app.Config.Tailscale.LoginServer
+	if loginServer == "" && app.Config.Tailscale.ControlPlane == "headscale" {
+		loginServer = app.Config.Tailscale.BaseURL
+	}
+	if loginServer != "" {
+		tailscaleArgs = append(tailscaleArgs, "--login-server="+loginServer)
+	}
+	// User data runs as root, and minimal images may not have sudo.
+	userDataScript := `#!/bin/bash
+# Allow ip forwarding
+echo 'net.ipv4.ip_forward = 1' | tee -a /etc/sysctl.conf
+echo 'net.ipv6.conf.all.forwarding = 1' | tee -a /etc/sysctl.conf
+sysctl -p /etc/sysctl.conf
+
+` + cloud.SetupScript() + `
+
+` + authKeyScript + `
+
+curl -fsSL https://tailscale.com/install.sh | sh
+tailscale up --auth-key=${AUTH_KEY} --hostname=` + provider.NodeName(region, "${INSTANCE_ID}") + ` ` + strings.Join(tailscaleArgs, " ")
+	if duration > 0 {
+		userDataScript += `
+echo "shutdown" | at now + ` + strconv.Itoa(int(duration.Minutes())) + ` minutes`
+	}
+	if idleTimeout > 0 {
+		userDataScript += "\n\n" + idleWatchScript(idleTimeout)
+	}
+	if notifier, ok := cloud.(provider.InterruptionNotifier); ok && market != provider.MarketOnDemand {
+		userDataScript += "\n\n" + drainWatchScript(notifier.InterruptionCheck(), provider.NodeName(region, "${INSTANCE_ID}"))
+	}
+
+	// Launch the instance. Nodes only shutting down once idle have no
+	// expiry.
+	var expiresAt *time.Time
+	tags := map[string]string{
+		provider.TagApp: "tailout",
+	}
+	if persistent {
+		tags[provider.TagExpiresAt] = provider.ExpiresNever
+	} else if duration > 0 {
+		t := time.Now().Add(duration)
+		expiresAt = &t
+		tags[provider.TagExpiresAt] = strconv.FormatInt(t.Unix(), 10)
+	}
+	createdInstance, err := cloud.Launch(context.TODO(), provider.LaunchInput{
+		Region:                region,
+		Image:                 image,
+		InstanceType:          instanceType,
+		FallbackInstanceTypes: app.Config.Create.FallbackInstanceTypes,
+		Market:                market,
+		UserData:              userDataScript,
+		AuthKey:               authKey,
+		TailscaleArgs:         tailscaleArgs,
+		Shutdown:              duration,
+		IdleTimeout:           idleTimeout,
+		Tags:                  tags,
+		DryRun:                dryRun,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to add tags to the instance: %w", err)
+		return fmt.Errorf("failed to launch instance: %w", err)
 	}
 
-	// Initialize loading spinner
-	var wg sync.WaitGroup
-	var s *chin.Chin
+	fmt.Fprintln(app.Err, "Instance created successfully:", createdInstance.ID)
+	if createdInstance.InstanceType != "" && createdInstance.Market != "" {
+		fmt.Fprintf(app.Err, "Launched as a %s %s instance.\n", createdInstance.Market, createdInstance.InstanceType)
+	}
+	nodeName := provider.NodeName(region, createdInstance.ID)
+	fmt.Fprintln(app.Err, "Instance will be named", nodeName)
+
+	// Until the node has joined the tailnet, a failure leaves an instance
+	// that is billed but unusable, so it is rolled back.
+	ready := false
+	defer func() {
+		if err == nil || ready {
+			return
+		}
+		if app.Config.Create.KeepOnFailure {
+			fmt.Fprintln(app.Err, "Keeping instance", createdInstance.ID, "for debugging, stop it with: tailout stop", nodeName)
+			return
+		}
+		app.rollbackNode(cloud, control, region, createdInstance.ID, nodeName)
+	}()
+
+	err = cloud.Tag(context.TODO(), region, createdInstance.ID, map[string]string{
+		provider.TagName: nodeName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag instance: %w", err)
+	}
 
+	// Initialize loading spinner, also stopped on failures so that the
+	// cursor is shown again.
+	var spinner *internal.Spinner
 	if !nonInteractive {
-		s = chin.New().WithWait(&wg)
-		go s.Start()
+		spinner = internal.StartSpinner(app.Err)
+		defer spinner.Stop()
 	}
 
-	fmt.Println("Waiting for instance to be running...")
+	fmt.Fprintln(app.Err, "Waiting for instance to be running...")
 
-	// Add a handler for the instance state change event
-	err = ec2.NewInstanceExistsWaiter(ec2Svc).Wait(context.TODO(), &ec2.DescribeInstancesInput{
-		InstanceIds: []string{*createdInstance.InstanceId},
-	}, time.Minute*2)
+	err = cloud.WaitRunning(context.TODO(), region, createdInstance.ID)
 	if err != nil {
-		return fmt.Errorf("failed to wait for instance to be created: %w", err)
+		return fmt.Errorf("failed to wait for instance to be running: %w", err)
 	}
 
-	fmt.Println("OK.")
-	fmt.Println("Waiting for instance to join tailnet...")
+	fmt.Fprintln(app.Err, "OK.")
+	fmt.Fprintln(app.Err, "Waiting for instance to join tailnet...")
 
 	// Call internal.GetNodes periodically and search for the instance
 	// If the instance is found, print the command to use it as an exit node
 
 	timeout := time.Now().Add(3 * time.Minute)
 
-	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
-	if err != nil {
-		return fmt.Errorf("failed to parse base URL: %w", err)
-	}
-
-	client := &tsapi.Client{
-		APIKey:  app.Config.Tailscale.APIKey,
-		Tailnet: app.Config.Tailscale.Tailnet,
-		BaseURL: baseURL,
-	}
-
+	var device controlplane.Node
 	for {
-		nodes, err := client.Devices().List(context.TODO())
+		nodes, err := control.Nodes(context.TODO())
 		if err != nil {
-			return fmt.Errorf("failed to get devices: %w", err)
+			return fmt.Errorf("failed to get nodes: %w", err)
 		}
 
 		for _, node := range nodes {
 			if node.Hostname == nodeName {
+				device = node
 				goto found
 			}
 		}
@@ -260,39 +373,60 @@ sudo echo "sudo shutdown" | at now + ` + strconv.Itoa(durationMinutes) + ` minut
 found:
 	// Stop the loading spinner
 	if !nonInteractive {
-		s.Stop()
-		wg.Wait()
+		spinner.Stop()
 	}
-	// Get public IP address of created instance
-	describeInput := &ec2.DescribeInstancesInput{
-		InstanceIds: []string{*createdInstance.InstanceId},
+
+	// Record the tailscale IP of the node so it can still be matched to its
+	// instance once renamed.
+	if len(device.Addresses) > 0 {
+		err = cloud.Tag(context.TODO(), region, createdInstance.ID, map[string]string{
+			provider.TagTailscaleIP: device.Addresses[0],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to tag instance: %w", err)
+		}
 	}
 
-	describeResult, err := ec2Svc.DescribeInstances(context.TODO(), describeInput)
+	// Get public IP address of created instance
+	publicIP, err := cloud.PublicIP(context.TODO(), region, createdInstance.ID)
 	if err != nil {
-		return fmt.Errorf("failed to describe EC2 instance: %w", err)
+		return fmt.Errorf("failed to get public IP address: %w", err)
 	}
 
-	if len(describeResult.Reservations) == 0 {
-		return errors.New("no reservations found")
+	ready = true
+
+	node := createdNode{
+		Hostname:     nodeName,
+		Addresses:    device.Addresses,
+		Region:       region,
+		InstanceID:   createdInstance.ID,
+		InstanceType: createdInstance.InstanceType,
+		Market:       createdInstance.Market,
+		PublicIP:     publicIP,
+		ExpiresAt:    expiresAt,
+		Persistent:   persistent,
 	}
-
-	reservation := describeResult.Reservations[0]
-	if len(reservation.Instances) == 0 {
-		return errors.New("no instances found")
+	if hasLocation {
+		node.Location = &location
 	}
-
-	instance := reservation.Instances[0]
-	if instance.PublicIpAddress == nil {
-		return errors.New("no public IP address found")
+	if app.structuredOutput() {
+		if err := app.printResult(node); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(app.Out, "Node %s joined tailnet.\n", nodeName)
+		fmt.Fprintln(app.Out, "Public IP address:", publicIP)
+		if persistent {
+			fmt.Fprintln(app.Out, "No planned termination, stop the node with: tailout stop", nodeName)
+		} else if expiresAt != nil {
+			fmt.Fprintln(app.Out, "Planned termination time:", expiresAt.Format(time.RFC3339))
+		} else {
+			fmt.Fprintln(app.Out, "No planned termination, the node shuts down once idle for", idleTimeout)
+		}
 	}
 
-	fmt.Printf("Node %s joined tailnet.\n", nodeName)
-	fmt.Println("Public IP address:", *instance.PublicIpAddress)
-	fmt.Println("Planned termination time:", time.Now().Add(duration).Format(time.RFC3339))
-
 	if connect {
-		fmt.Println()
+		fmt.Fprintln(app.Err)
 		args := []string{nodeName}
 		err = app.Connect(args)
 		if err != nil {
@@ -301,3 +435,92 @@ found:
 	}
 	return nil
 }
+
+// rollbackNode terminates the instance of a node that failed to be created,
+// and deletes the tailnet device it may have registered.
+func (app *App) rollbackNode(cloud provider.Provider, control controlplane.ControlPlane, region, instanceID, nodeName string) {
+	fmt.Fprintln(app.Err, "Rolling back node", nodeName)
+
+	if err := cloud.Terminate(context.TODO(), region, instanceID, false); err != nil {
+		fmt.Fprintln(app.Err, "Failed to terminate instance", instanceID+":", err)
+	} else {
+		fmt.Fprintln(app.Err, "Terminated instance", instanceID)
+	}
+
+	devices, err := control.Nodes(context.TODO())
+	if err != nil {
+		fmt.Fprintln(app.Err, "Failed to get nodes:", err)
+		return
+	}
+
+	for _, device := range devices {
+		if device.Hostname != nodeName {
+			continue
+		}
+		if err := control.DeleteNode(context.TODO(), device.ID); err != nil {
+			fmt.Fprintln(app.Err, "Failed to delete node", device.Hostname+":", err)
+		} else {
+			fmt.Fprintln(app.Err, "Deleted node", device.Hostname)
+		}
+	}
+}
+
+// idleTrafficThreshold is the number of bytes per minute going through the
+// tailscale interface below which a node is considered idle, so that
+// keepalives and background tailnet traffic do not keep it up.
+const idleTrafficThreshold = 64 * 1024
+
+// idleWatchScript returns shell commands installing a service that shuts the
+// node down once less than idleTrafficThreshold bytes per minute have gone
+// through the tailscale interface for the given duration.
+func idleWatchScript(idleTimeout time.Duration) string {
+	return `cat <<'EOF' | tee /usr/local/bin/tailout-idle-watch
+#!/bin/bash
+counters() {
+  echo $(( $(cat /sys/class/net/tailscale0/statistics/rx_bytes) + $(cat /sys/class/net/tailscale0/statistics/tx_bytes) ))
+}
+idle=0
+last=$(counters)
+while sleep 60; do
+  current=$(counters)
+  if [ $((current - last)) -lt ` + strconv.Itoa(idleTrafficThreshold) + ` ]; then
+    idle=$((idle + 1))
+  else
+    idle=0
+  fi
+  last=$current
+  if [ $idle -ge ` + strconv.Itoa(int(idleTimeout.Minutes())) + ` ]; then
+    shutdown now
+  fi
+done
+EOF
+chmod +x /usr/local/bin/tailout-idle-watch
+systemd-run --unit tailout-idle-watch /usr/local/bin/tailout-idle-watch`
+}
+
+// drainingSuffix is appended to the hostname of nodes about to be reclaimed
+// by their provider, so that clients can move to another node in time.
+const drainingSuffix = "-draining"
+
+// draining reports whether the node with the given hostname is about to be
+// reclaimed.
+func draining(hostname string) bool {
+	return strings.HasSuffix(hostname, drainingSuffix)
+}
+
+// drainWatchScript returns shell commands installing a service that renames
+// the node with drainingSuffix once the interruption check succeeds.
+func drainWatchScript(interruptionCheck, nodeName string) string {
+	return `cat <<'EOF' | tee /usr/local/bin/tailout-drain-watch
+#!/bin/bash
+interrupted() {
+` + interruptionCheck + `
+}
+until interrupted; do
+  sleep 5
+done
+tailscale set --hostname="$1` + drainingSuffix + `"
+EOF
+chmod +x /usr/local/bin/tailout-drain-watch
+systemd-run --unit tailout-drain-watch /usr/local/bin/tailout-drain-watch ` + nodeName
+}
@@ -0,0 +1,125 @@
+package tailout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+func TestCreate(t *testing.T) {
+	app, cloud, control := newFakeApp()
+	app.Config.Output = "json"
+
+	if err := app.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	var node createdNode
+	if err := json.Unmarshal(app.Out.(*bytes.Buffer).Bytes(), &node); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if node.Hostname != provider.NodeName("fake-1", "i-1") || node.PublicIP != "203.0.113.1" || node.ExpiresAt == nil {
+		t.Errorf("unexpected created node: %+v", node)
+	}
+	if len(cloud.instances) != 1 || !cloud.instances[0].HasTag(provider.TagTailscaleIP, node.Addresses[0]) {
+		t.Errorf("instance not tagged with its tailscale IP: %+v", cloud.instances)
+	}
+	if control.authKeys != 1 || control.revokedKeys != 1 {
+		t.Errorf("created %d auth keys and revoked %d, want 1 and 1", control.authKeys, control.revokedKeys)
+	}
+}
+
+func TestCreateShutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		shutdown    string
+		idleTimeout string
+		scheduled   bool
+		expiresAt   string
+		ephemeral   bool
+	}{
+		{"default", "", "", true, "timestamp", true},
+		{"duration", "30m", "", true, "timestamp", true},
+		{"persistent", "never", "", false, provider.ExpiresNever, false},
+		{"idle timeout", "", "15m", false, "", true},
+		{"idle timeout and duration", "4h", "15m", true, "timestamp", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, control := newFakeApp()
+			app.Config.Create.Shutdown = tt.shutdown
+			app.Config.Create.IdleTimeout = tt.idleTimeout
+
+			if err := app.Create(); err != nil {
+				t.Fatal(err)
+			}
+
+			input := cloud.launched[0]
+			if scheduled := strings.Contains(input.UserData, "| at now +"); scheduled != tt.scheduled {
+				t.Errorf("shutdown scheduled = %v, want %v", scheduled, tt.scheduled)
+			}
+			if idle := strings.Contains(input.UserData, "tailout-idle-watch"); idle != (tt.idleTimeout != "") {
+				t.Errorf("idle watch installed = %v, want %v", idle, tt.idleTimeout != "")
+			}
+			expiresAt, tagged := input.Tags[provider.TagExpiresAt]
+			switch tt.expiresAt {
+			case "":
+				if tagged {
+					t.Errorf("unexpected expiry tag %q", expiresAt)
+				}
+			case "timestamp":
+				if _, ok := cloud.instances[0].ExpiresAt(); !ok {
+					t.Errorf("expiry tag %q is not a timestamp", expiresAt)
+				}
+			default:
+				if expiresAt != tt.expiresAt {
+					t.Errorf("expiry tag %q, want %q", expiresAt, tt.expiresAt)
+				}
+			}
+			if len(control.ephemeral) != 1 || control.ephemeral[0] != tt.ephemeral {
+				t.Errorf("auth keys ephemeral %v, want [%v]", control.ephemeral, tt.ephemeral)
+			}
+		})
+	}
+}
+
+func TestCreateRollback(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepOnFailure bool
+	}{
+		{"rollback", false},
+		{"keep on failure", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, control := newFakeApp()
+			app.Config.Create.KeepOnFailure = tt.keepOnFailure
+			cloud.tagErr = errors.New("tagging failed")
+
+			if err := app.Create(); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if tt.keepOnFailure {
+				if len(cloud.instances) != 1 || len(control.nodes) != 1 {
+					t.Errorf("kept %d instances and %d nodes, want 1 and 1", len(cloud.instances), len(control.nodes))
+				}
+			} else {
+				if len(cloud.instances) != 0 || len(cloud.terminated) != 1 {
+					t.Errorf("instances %v left, terminated %v", cloud.instances, cloud.terminated)
+				}
+				if len(control.nodes) != 0 || len(control.deleted) != 1 {
+					t.Errorf("nodes %v left, deleted %v", control.nodes, control.deleted)
+				}
+			}
+			if control.revokedKeys != control.authKeys {
+				t.Errorf("created %d auth keys but revoked %d", control.authKeys, control.revokedKeys)
+			}
+		})
+	}
+}
@@ -35,6 +35,6 @@ func (app *App) Disconnect() error {
 		return fmt.Errorf("failed to run tailscale up command: %w", err)
 	}
 
-	fmt.Println("Disconnected.")
+	fmt.Fprintln(app.Err, "Disconnected.")
 	return nil
 }
@@ -0,0 +1,141 @@
+package tailout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/cterence/tailout/internal"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+// cancelShutdownCommand removes the jobs of the at queue of a node, which only
+// holds its scheduled shutdown.
+const cancelShutdownCommand = `for job in $(atq | cut -f1); do atrm "$job"; done`
+
+func (app *App) Extend(args []string) error {
+	never := app.Config.Extend.Never
+
+	var extension time.Duration
+	switch {
+	case len(args) == 0:
+		return errors.New("no node name provided")
+	case never && len(args) > 1:
+		return errors.New("a duration cannot be given along with --never")
+	case !never && len(args) < 2:
+		return errors.New("no duration provided")
+	case !never:
+		var err error
+		extension, err = time.ParseDuration(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to parse duration: %w", err)
+		}
+		if extension <= 0 {
+			return errors.New("duration must be positive")
+		}
+	}
+
+	control, err := app.controlPlane()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := internal.GetActiveNodes(control)
+	if err != nil {
+		return fmt.Errorf("failed to get active nodes: %w", err)
+	}
+
+	var node controlplane.Node
+	for _, n := range nodes {
+		if n.Hostname == args[0] {
+			node = n
+		}
+	}
+	if node.ID == "" {
+		return fmt.Errorf("node %s not found in your tailnet", args[0])
+	}
+
+	cloud, err := app.provider()
+	if err != nil {
+		return err
+	}
+
+	instances, err := cloud.List(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	instance, found := findInstance(instances, node)
+	if !found {
+		return fmt.Errorf("no instance found for node %s", node.Hostname)
+	}
+
+	command := cancelShutdownCommand
+	expiresAtTag := provider.ExpiresNever
+	var expiresAt time.Time
+	if !never {
+		// The extension is added to the current expiry, unless it is unknown
+		// or already past.
+		expiresAt = time.Now()
+		if current, ok := instance.ExpiresAt(); ok && current.After(expiresAt) {
+			expiresAt = current
+		}
+		expiresAt = expiresAt.Add(extension)
+
+		minutes := int(math.Ceil(time.Until(expiresAt).Minutes()))
+		command += `; echo "shutdown" | at now + ` + strconv.Itoa(minutes) + ` minutes`
+		expiresAtTag = strconv.FormatInt(expiresAt.Unix(), 10)
+	}
+
+	// Providers enforcing the expiry of their machines only need the tag
+	// to be updated.
+	if enforcer, ok := cloud.(provider.ExpiryEnforcer); !ok || !enforcer.EnforcesExpiry() {
+		fmt.Fprintln(app.Err, "Rescheduling the shutdown of", node.Hostname)
+		if err := app.runOnNode(node, command); err != nil {
+			return fmt.Errorf("failed to reschedule shutdown on the node: %w", err)
+		}
+	}
+
+	err = cloud.Tag(context.TODO(), instance.Region, instance.ID, map[string]string{
+		provider.TagExpiresAt: expiresAtTag,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag instance: %w", err)
+	}
+
+	if never {
+		fmt.Fprintln(app.Out, "Node", node.Hostname, "will no longer shut down on its own")
+	} else {
+		fmt.Fprintln(app.Out, "Node", node.Hostname, "will shut down at", expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// runOnNode runs a shell command as root on a node through Tailscale SSH,
+// which tailout init allows for tailout nodes.
+func (app *App) runOnNode(node controlplane.Node, command string) error {
+	if len(node.Addresses) == 0 {
+		return fmt.Errorf("node %s has no tailscale address", node.Hostname)
+	}
+
+	// Stdin is kept so that Tailscale SSH can ask for a check in the browser.
+	cmd := exec.CommandContext(context.TODO(), "ssh", "-o", "StrictHostKeyChecking=accept-new", "root@"+node.Addresses[0], command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = app.Err
+	cmd.Stderr = app.Err
+	if err := cmd.Run(); err != nil {
+		// ssh exits with 255 when it could not connect or log in.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 255 {
+			return fmt.Errorf("failed to connect to %s with ssh, make sure the policy of your tailnet allows Tailscale SSH to tag:tailout nodes as root, see tailout init: %w", node.Hostname, err)
+		}
+		return fmt.Errorf("ssh: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package tailout
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+func TestExtend(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt string
+		args      []string
+		never     bool
+		want      time.Duration
+	}{
+		{"from current expiry", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10), []string{"2h"}, false, 3 * time.Hour},
+		{"from now when expired", strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10), []string{"2h"}, false, 2 * time.Hour},
+		{"from now without expiry", "", []string{"30m"}, false, 30 * time.Minute},
+		{"never", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10), nil, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, _ := newFakeApp()
+			cloud.enforcesExpiry = true
+			if err := app.Create(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.expiresAt == "" {
+				delete(cloud.instances[0].Tags, provider.TagExpiresAt)
+			} else {
+				cloud.instances[0].Tags[provider.TagExpiresAt] = tt.expiresAt
+			}
+			app.Config.Extend.Never = tt.never
+
+			if err := app.Extend(append([]string{provider.NodeName("fake-1", "i-1")}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+
+			instance := cloud.instances[0]
+			if tt.never {
+				if !instance.Persistent() {
+					t.Errorf("expiry tag %q, want %q", instance.Tags[provider.TagExpiresAt], provider.ExpiresNever)
+				}
+				return
+			}
+			expiresAt, ok := instance.ExpiresAt()
+			if !ok {
+				t.Fatalf("expiry tag %q is not a timestamp", instance.Tags[provider.TagExpiresAt])
+			}
+			if got := time.Until(expiresAt); got < tt.want-time.Minute || got > tt.want {
+				t.Errorf("expires in %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		never bool
+	}{
+		{"no node", nil, false},
+		{"no duration", []string{"tailout-fake-1-i-1"}, false},
+		{"negative duration", []string{"tailout-fake-1-i-1", "-1h"}, false},
+		{"duration with never", []string{"tailout-fake-1-i-1", "1h"}, true},
+		{"unknown node", []string{"tailout-fake-1-i-42", "1h"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, _ := newFakeApp()
+			cloud.enforcesExpiry = true
+			if err := app.Create(); err != nil {
+				t.Fatal(err)
+			}
+			tag := cloud.instances[0].Tags[provider.TagExpiresAt]
+			app.Config.Extend.Never = tt.never
+
+			if err := app.Extend(tt.args); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := cloud.instances[0].Tags[provider.TagExpiresAt]; got != tag {
+				t.Errorf("expiry tag changed from %q to %q", tag, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package tailout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cterence/tailout/tailout/config"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+	tsapi "tailscale.com/client/tailscale/v2"
+)
+
+// fakeProvider is an in-memory provider whose instances join the tailnet of
+// control as soon as they are launched.
+type fakeProvider struct {
+	control    *fakeControlPlane
+	launched   []provider.LaunchInput
+	instances  []provider.Instance
+	terminated []string
+	// tagErr is returned when tagging an instance.
+	tagErr error
+	// enforcesExpiry makes the provider an ExpiryEnforcer.
+	enforcesExpiry bool
+	// unused are the resources left to collect, moved to collected once
+	// deleted.
+	unused    []string
+	collected []string
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Account(ctx context.Context) (string, error) { return "test", nil }
+
+func (p *fakeProvider) Regions(ctx context.Context) ([]string, error) {
+	return []string{"fake-1", "fake-2"}, nil
+}
+
+func (p *fakeProvider) DefaultInstanceType() string { return "small" }
+
+func (p *fakeProvider) FindImage(ctx context.Context, region, instanceType string) (provider.Image, error) {
+	return provider.Image{ID: "image"}, nil
+}
+
+func (p *fakeProvider) SetupScript() string { return "INSTANCE_ID=$(hostname)" }
+
+func (p *fakeProvider) Launch(ctx context.Context, input provider.LaunchInput) (provider.Instance, error) {
+	p.launched = append(p.launched, input)
+	instance := provider.Instance{
+		ID:           "i-" + strconv.Itoa(len(p.instances)+len(p.terminated)+1),
+		Region:       input.Region,
+		InstanceType: input.InstanceType,
+		Tags:         map[string]string{},
+	}
+	for key, value := range input.Tags {
+		instance.Tags[key] = value
+	}
+	p.instances = append(p.instances, instance)
+	if p.control != nil {
+		p.control.nodes = append(p.control.nodes, controlplane.Node{
+			ID:        "n-" + instance.ID,
+			Name:      provider.NodeName(input.Region, instance.ID) + ".tailnet.ts.net",
+			Hostname:  provider.NodeName(input.Region, instance.ID),
+			Addresses: []string{"100.64.0." + strconv.Itoa(len(p.control.nodes)+1)},
+			Tags:      []string{"tag:tailout"},
+			Online:    true,
+		})
+	}
+	return instance, nil
+}
+
+func (p *fakeProvider) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	if p.tagErr != nil {
+		return p.tagErr
+	}
+	for _, instance := range p.instances {
+		if instance.ID == id {
+			for key, value := range tags {
+				instance.Tags[key] = value
+			}
+			return nil
+		}
+	}
+	return errors.New("instance not found")
+}
+
+func (p *fakeProvider) WaitRunning(ctx context.Context, region, id string) error { return nil }
+
+func (p *fakeProvider) PublicIP(ctx context.Context, region, id string) (string, error) {
+	return "203.0.113.1", nil
+}
+
+func (p *fakeProvider) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	i := slices.IndexFunc(p.instances, func(instance provider.Instance) bool {
+		return instance.ID == id && instance.Region == region
+	})
+	if i < 0 {
+		return errors.New("instance not found")
+	}
+	if !dryRun {
+		p.instances = slices.Delete(p.instances, i, i+1)
+		p.terminated = append(p.terminated, id)
+	}
+	return nil
+}
+
+func (p *fakeProvider) List(ctx context.Context) ([]provider.Instance, error) {
+	return slices.Clone(p.instances), nil
+}
+
+func (p *fakeProvider) EnforcesExpiry() bool { return p.enforcesExpiry }
+
+func (p *fakeProvider) CollectResources(ctx context.Context, dryRun bool) ([]string, error) {
+	resources := slices.Clone(p.unused)
+	if !dryRun {
+		p.collected = append(p.collected, p.unused...)
+		p.unused = nil
+	}
+	return resources, nil
+}
+
+// fakeControlPlane is an in-memory control plane.
+type fakeControlPlane struct {
+	nodes       []controlplane.Node
+	deleted     []string
+	authKeys    int
+	revokedKeys int
+	// ephemeral records whether each auth key created was ephemeral.
+	ephemeral []bool
+}
+
+func (c *fakeControlPlane) Nodes(ctx context.Context) ([]controlplane.Node, error) {
+	return slices.Clone(c.nodes), nil
+}
+
+func (c *fakeControlPlane) DeleteNode(ctx context.Context, id string) error {
+	i := slices.IndexFunc(c.nodes, func(node controlplane.Node) bool { return node.ID == id })
+	if i < 0 {
+		return errors.New("node not found")
+	}
+	c.nodes = slices.Delete(c.nodes, i, i+1)
+	c.deleted = append(c.deleted, id)
+	return nil
+}
+
+func (c *fakeControlPlane) CreateAuthKey(ctx context.Context, expiry time.Duration, tags []string, ephemeral bool) (controlplane.AuthKey, error) {
+	c.authKeys++
+	c.ephemeral = append(c.ephemeral, ephemeral)
+	return controlplane.AuthKey{ID: "k-" + strconv.Itoa(c.authKeys), Key: "tskey-test"}, nil
+}
+
+func (c *fakeControlPlane) DeleteAuthKey(ctx context.Context, key controlplane.AuthKey) error {
+	c.revokedKeys++
+	return nil
+}
+
+func (c *fakeControlPlane) Policy(ctx context.Context) (*tsapi.ACL, error) { return &tsapi.ACL{}, nil }
+
+func (c *fakeControlPlane) ValidatePolicy(ctx context.Context, policy tsapi.ACL) error { return nil }
+
+func (c *fakeControlPlane) SetPolicy(ctx context.Context, policy tsapi.ACL) error { return nil }
+
+// newFakeApp returns a non-interactive app managing nodes with a fake
+// provider and control plane.
+func newFakeApp() (*App, *fakeProvider, *fakeControlPlane) {
+	control := &fakeControlPlane{}
+	cloud := &fakeProvider{control: control}
+	app := &App{
+		Config: &config.Config{
+			NonInteractive: true,
+			Region:         "fake-1",
+			Create:         config.CreateConfig{Shutdown: "2h", Market: provider.MarketSpot},
+		},
+		Provider:     cloud,
+		ControlPlane: control,
+		Out:          &bytes.Buffer{},
+		Err:          &bytes.Buffer{},
+	}
+	return app, cloud, control
+}
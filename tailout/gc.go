@@ -0,0 +1,184 @@
+package tailout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cterence/tailout/internal"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+// gcGracePeriod is how long an instance has to join the tailnet before it is
+// considered orphaned, and how long a device must have been offline before it
+// is considered dead.
+const gcGracePeriod = 15 * time.Minute
+
+func (app *App) GC() error {
+	nonInteractive := app.Config.NonInteractive
+	dryRun := app.Config.DryRun
+
+	control, err := app.controlPlane()
+	if err != nil {
+		return err
+	}
+
+	cloud, err := app.provider()
+	if err != nil {
+		return err
+	}
+
+	devices, err := control.Nodes(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	instances, err := cloud.List(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	// Devices whose instance is gone are only deleted once offline, since
+	// they may run on another provider.
+	matched := map[string]bool{}
+	deadDevices := []controlplane.Node{}
+	for _, device := range devices {
+		if !slices.Contains(device.Tags, "tag:tailout") {
+			continue
+		}
+
+		instance, found := findInstance(instances, device)
+		if found {
+			matched[instanceKey(instance)] = true
+			continue
+		}
+
+		if !device.Online && device.LastSeen != nil && time.Since(*device.LastSeen) > gcGracePeriod {
+			deadDevices = append(deadDevices, device)
+		}
+	}
+
+	// Persistent instances are long-lived nodes, they are shown but never
+	// terminated by gc.
+	orphanedInstances := []provider.Instance{}
+	persistentInstances := []provider.Instance{}
+	for _, instance := range instances {
+		if instance.Persistent() {
+			persistentInstances = append(persistentInstances, instance)
+			continue
+		}
+		// Powered off instances left their node and are still billed.
+		if !instance.Stopped && (matched[instanceKey(instance)] || time.Since(instance.CreatedAt) < gcGracePeriod) {
+			continue
+		}
+		orphanedInstances = append(orphanedInstances, instance)
+	}
+
+	if len(persistentInstances) > 0 {
+		fmt.Fprintln(app.Err, "The following persistent instances are kept:")
+		for _, instance := range persistentInstances {
+			state := "in the tailnet"
+			if !matched[instanceKey(instance)] {
+				state = "not in the tailnet"
+			}
+			fmt.Fprintf(app.Err, "- %s in %s, %s\n", instance.ID, instance.Region, state)
+		}
+	}
+
+	// Resources left behind by instances that terminated themselves.
+	collector, collect := cloud.(provider.ResourceCollector)
+	unusedResources := []string{}
+	if collect {
+		unusedResources, err = collector.CollectResources(context.TODO(), true)
+		if err != nil {
+			return fmt.Errorf("failed to list unused resources: %w", err)
+		}
+	}
+
+	if len(orphanedInstances) == 0 && len(deadDevices) == 0 && len(unusedResources) == 0 {
+		fmt.Fprintln(app.Err, "Nothing to clean up")
+		return nil
+	}
+
+	if len(orphanedInstances) > 0 {
+		fmt.Fprintln(app.Err, "The following instances never joined the tailnet, lost their node or are powered off, they will be terminated:")
+		for _, instance := range orphanedInstances {
+			state := "created " + instance.CreatedAt.Format(time.RFC3339)
+			if instance.Stopped {
+				state = "powered off"
+			}
+			fmt.Fprintf(app.Err, "- %s in %s, %s\n", instance.ID, instance.Region, state)
+		}
+	}
+
+	if len(deadDevices) > 0 {
+		fmt.Fprintln(app.Err, "The following nodes have no instance left, they will be deleted from the tailnet:")
+		for _, device := range deadDevices {
+			fmt.Fprintf(app.Err, "- %s, last seen %s\n", device.Hostname, device.LastSeen.Format(time.RFC3339))
+		}
+	}
+
+	if len(unusedResources) > 0 {
+		fmt.Fprintln(app.Err, "The following resources are no longer used by any instance, they will be deleted:")
+		for _, resource := range unusedResources {
+			fmt.Fprintln(app.Err, "-", resource)
+		}
+	}
+
+	if dryRun {
+		fmt.Fprintln(app.Err, "Dry run mode, no changes were made")
+		return nil
+	}
+
+	if !nonInteractive {
+		result, err := internal.PromptYesNo("Do you want to clean up these resources?")
+		if err != nil {
+			return fmt.Errorf("failed to prompt for confirmation: %w", err)
+		}
+
+		if !result {
+			fmt.Fprintln(app.Err, "Aborting...")
+			return nil
+		}
+	}
+
+	// Keep going on failures, so that one stuck resource does not prevent
+	// cleaning up the others.
+	var errs []error
+	for _, instance := range orphanedInstances {
+		if err := cloud.Terminate(context.TODO(), instance.Region, instance.ID, false); err != nil {
+			errs = append(errs, fmt.Errorf("failed to terminate instance %s: %w", instance.ID, err))
+			continue
+		}
+		fmt.Fprintln(app.Err, "Successfully terminated instance", instance.ID)
+	}
+
+	for _, device := range deadDevices {
+		if err := control.DeleteNode(context.TODO(), device.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete node %s: %w", device.Hostname, err))
+			continue
+		}
+		fmt.Fprintln(app.Err, "Successfully deleted node", device.Hostname)
+	}
+
+	if len(unusedResources) > 0 {
+		collected, err := collector.CollectResources(context.TODO(), false)
+		for _, resource := range collected {
+			fmt.Fprintln(app.Err, "Successfully deleted", resource)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete unused resources: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// instanceKey identifies an instance, as IDs are only unique per region on
+// some providers.
+func instanceKey(instance provider.Instance) string {
+	return instance.Region + "/" + instance.ID
+}
@@ -0,0 +1,62 @@
+package tailout
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+func TestGC(t *testing.T) {
+	tests := []struct {
+		name           string
+		dryRun         bool
+		wantTerminated []string
+		wantDeleted    []string
+		wantCollected  []string
+	}{
+		{"clean up", false, []string{"orphaned", "powered-off"}, []string{"n-dead"}, []string{"security group sg-1 in fake-1"}},
+		{"dry run", true, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, control := newFakeApp()
+			app.Config.DryRun = tt.dryRun
+			now := time.Now()
+			hourAgo := now.Add(-time.Hour)
+			never := map[string]string{provider.TagExpiresAt: provider.ExpiresNever}
+			cloud.instances = []provider.Instance{
+				{ID: "joined", Region: "fake-1", CreatedAt: hourAgo},
+				{ID: "orphaned", Region: "fake-1", CreatedAt: hourAgo},
+				{ID: "booting", Region: "fake-1", CreatedAt: now},
+				{ID: "powered-off", Region: "fake-2", CreatedAt: hourAgo, Stopped: true},
+				{ID: "persistent", Region: "fake-2", CreatedAt: hourAgo, Tags: never},
+			}
+			control.nodes = []controlplane.Node{
+				{ID: "n-joined", Hostname: provider.NodeName("fake-1", "joined"), Tags: []string{"tag:tailout"}, Online: true},
+				{ID: "n-powered-off", Hostname: provider.NodeName("fake-2", "powered-off"), Tags: []string{"tag:tailout"}, LastSeen: &hourAgo},
+				{ID: "n-dead", Hostname: provider.NodeName("fake-1", "gone"), Tags: []string{"tag:tailout"}, LastSeen: &hourAgo},
+				{ID: "n-recent", Hostname: provider.NodeName("fake-1", "restarting"), Tags: []string{"tag:tailout"}, LastSeen: &now},
+				{ID: "n-laptop", Hostname: "laptop", LastSeen: &hourAgo},
+			}
+			cloud.unused = []string{"security group sg-1 in fake-1"}
+
+			if err := app.GC(); err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(cloud.terminated)
+			if !slices.Equal(cloud.terminated, tt.wantTerminated) {
+				t.Errorf("terminated %v, want %v", cloud.terminated, tt.wantTerminated)
+			}
+			if !slices.Equal(control.deleted, tt.wantDeleted) {
+				t.Errorf("deleted nodes %v, want %v", control.deleted, tt.wantDeleted)
+			}
+			if !slices.Equal(cloud.collected, tt.wantCollected) {
+				t.Errorf("collected %v, want %v", cloud.collected, tt.wantCollected)
+			}
+		})
+	}
+}
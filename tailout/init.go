@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/url"
 
 	"github.com/cterence/tailout/internal"
 	tsapi "tailscale.com/client/tailscale/v2"
@@ -14,19 +13,13 @@ func (app *App) Init() error {
 	dryRun := app.Config.DryRun
 	nonInteractive := app.Config.NonInteractive
 
-	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
+	control, err := app.controlPlane()
 	if err != nil {
-		return fmt.Errorf("failed to parse base URL: %w", err)
-	}
-
-	apiClient := &tsapi.Client{
-		APIKey:  app.Config.Tailscale.APIKey,
-		Tailnet: app.Config.Tailscale.Tailnet,
-		BaseURL: baseURL,
+		return err
 	}
 
 	// Get the ACL configuration
-	acl, err := apiClient.PolicyFile().Get(context.TODO())
+	acl, err := control.Policy(context.TODO())
 	if err != nil {
 		return fmt.Errorf("failed to get acl: %w", err)
 	}
@@ -50,6 +43,9 @@ func (app *App) Init() error {
 		fmt.Println("Tag 'tag:tailout' already exists.")
 		tailoutTagExists = true
 	} else {
+		if acl.TagOwners == nil {
+			acl.TagOwners = map[string][]string{}
+		}
 		acl.TagOwners["tag:tailout"] = []string{}
 	}
 
@@ -81,7 +77,7 @@ func (app *App) Init() error {
 	}
 
 	// Validate the updated acl configuration
-	err = apiClient.PolicyFile().Validate(context.TODO(), *acl)
+	err = control.ValidatePolicy(context.TODO(), *acl)
 	if err != nil {
 		return fmt.Errorf("failed to validate acl: %w", err)
 	}
@@ -116,7 +112,7 @@ Your new acl document will look like this:
 			}
 		}
 
-		err = apiClient.PolicyFile().Set(context.TODO(), *acl, "")
+		err = control.SetPolicy(context.TODO(), *acl)
 		if err != nil {
 			return fmt.Errorf("failed to update acl: %w", err)
 		}
@@ -0,0 +1,36 @@
+package tailout
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// structuredOutput reports whether results are printed as JSON or YAML
+// rather than as text.
+func (app *App) structuredOutput() bool {
+	return app.Config.Output == "json" || app.Config.Output == "yaml"
+}
+
+// printResult writes the result of a command to stdout in the configured
+// structured format.
+func (app *App) printResult(result any) error {
+	switch app.Config.Output {
+	case "json":
+		encoder := json.NewEncoder(app.Out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+	case "yaml":
+		encoder := yaml.NewEncoder(app.Out)
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,566 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	tailoutconfig "github.com/cterence/tailout/tailout/config"
+)
+
+// AWS launches exit nodes as EC2 spot instances.
+type AWS struct {
+	config tailoutconfig.AWSConfig
+}
+
+func NewAWS(c tailoutconfig.AWSConfig) *AWS {
+	return &AWS{
+		config: c,
+	}
+}
+
+func (p *AWS) Name() string {
+	return "aws"
+}
+
+func (p *AWS) loadConfig(ctx context.Context, region string) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (p *AWS) ec2Client(ctx context.Context, region string) (*ec2.Client, error) {
+	cfg, err := p.loadConfig(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return ec2.NewFromConfig(cfg), nil
+}
+
+func (p *AWS) Account(ctx context.Context) (string, error) {
+	cfg, err := p.loadConfig(ctx, "us-east-1")
+	if err != nil {
+		return "", err
+	}
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get account ID: %w", err)
+	}
+
+	return "AWS account " + *identity.Account, nil
+}
+
+func (p *AWS) Regions(ctx context.Context) ([]string, error) {
+	ec2Svc, err := p.ec2Client(ctx, "us-east-1")
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err := ec2Svc.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe regions: %w", err)
+	}
+
+	regionNames := []string{}
+	for _, region := range regions.Regions {
+		regionNames = append(regionNames, *region.RegionName)
+	}
+
+	return regionNames, nil
+}
+
+func (p *AWS) DefaultInstanceType() string {
+	return string(types.InstanceTypeT3aMicro)
+}
+
+// FindImage validates the instance type and returns the latest Amazon Linux
+// AMI for its architecture, so that Graviton instance types get an arm64 AMI.
+func (p *AWS) FindImage(ctx context.Context, region, instanceType string) (Image, error) {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return Image{}, err
+	}
+
+	instanceTypes, err := ec2Svc.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []types.InstanceType{types.InstanceType(instanceType)},
+	})
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to describe instance type %s: %w", instanceType, err)
+	}
+
+	if len(instanceTypes.InstanceTypes) == 0 || instanceTypes.InstanceTypes[0].ProcessorInfo == nil {
+		return Image{}, fmt.Errorf("instance type %s is not available in %s", instanceType, region)
+	}
+
+	architecture := ""
+	for _, supported := range instanceTypes.InstanceTypes[0].ProcessorInfo.SupportedArchitectures {
+		if supported == types.ArchitectureTypeX8664 || supported == types.ArchitectureTypeArm64 {
+			architecture = string(supported)
+			break
+		}
+	}
+
+	if architecture == "" {
+		return Image{}, fmt.Errorf("instance type %s has no architecture supported by Amazon Linux 2023", instanceType)
+	}
+
+	// DescribeImages to get the latest Amazon Linux AMI
+	amazonLinuxImages, err := ec2Svc.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("name"),
+				Values: []string{"al2023-ami-*"},
+			},
+			{
+				Name:   aws.String("state"),
+				Values: []string{"available"},
+			},
+			{
+				Name:   aws.String("is-public"),
+				Values: []string{"true"},
+			},
+			{
+				Name:   aws.String("architecture"),
+				Values: []string{architecture},
+			},
+		},
+		Owners: []string{"amazon"},
+	})
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to describe Amazon Linux images: %w", err)
+	}
+
+	if len(amazonLinuxImages.Images) == 0 {
+		return Image{}, errors.New("no Amazon Linux images found")
+	}
+
+	sort.Slice(amazonLinuxImages.Images, func(i, j int) bool {
+		return *amazonLinuxImages.Images[i].CreationDate > *amazonLinuxImages.Images[j].CreationDate
+	})
+
+	// Get the latest Amazon Linux AMI
+	latestAMI := amazonLinuxImages.Images[0]
+
+	return Image{
+		ID:   *latestAMI.ImageId,
+		Name: aws.ToString(latestAMI.Name),
+	}, nil
+}
+
+func (p *AWS) SetupScript() string {
+	return `TOKEN=$(curl -sSL -X PUT "http://169.254.169.254/latest/api/token" -H "X-aws-ec2-metadata-token-ttl-seconds: 30")
+INSTANCE_ID=$(curl -sSL -H "X-aws-ec2-metadata-token: ${TOKEN}" http://169.254.169.254/latest/meta-data/instance-id)`
+}
+
+// InterruptionCheck succeeds once the instance metadata holds a spot
+// interruption notice, sent two minutes before the instance is reclaimed.
+func (p *AWS) InterruptionCheck() string {
+	return `TOKEN=$(curl -sS -X PUT "http://169.254.169.254/latest/api/token" -H "X-aws-ec2-metadata-token-ttl-seconds: 30")
+curl -sf -o /dev/null -H "X-aws-ec2-metadata-token: ${TOKEN}" http://169.254.169.254/latest/meta-data/spot/instance-action`
+}
+
+// Launch tries every availability zone of the region for each instance type
+// and market, in order, until one of them has capacity left. Fallback
+// instance types are launched from the AMI of their own architecture.
+func (p *AWS) Launch(ctx context.Context, input LaunchInput) (Instance, error) {
+	ec2Svc, err := p.ec2Client(ctx, input.Region)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	markets := []string{MarketSpot}
+	switch input.Market {
+	case MarketOnDemand:
+		markets = []string{MarketOnDemand}
+	case MarketSpotThenOnDemand:
+		markets = []string{MarketSpot, MarketOnDemand}
+	}
+
+	network, err := p.network(ctx, ec2Svc)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	instanceTypes := append([]string{input.InstanceType}, input.FallbackInstanceTypes...)
+	images := map[string]Image{input.InstanceType: input.Image}
+	for _, instanceType := range input.FallbackInstanceTypes {
+		image, err := p.FindImage(ctx, input.Region, instanceType)
+		if err != nil {
+			return Instance{}, fmt.Errorf("failed to find image of fallback instance type %s: %w", instanceType, err)
+		}
+		images[instanceType] = image
+	}
+
+	securityGroupIDs := p.config.SecurityGroupIDs
+	if p.config.ManagedSecurityGroup && !input.DryRun {
+		var groupID string
+		groupID, err = p.createSecurityGroup(ctx, ec2Svc, network.vpcID, input.Tags)
+		if err != nil {
+			if groupID != "" {
+				_ = p.deleteManagedSecurityGroups(ctx, ec2Svc, []string{groupID})
+			}
+			return Instance{}, err
+		}
+		securityGroupIDs = append([]string{groupID}, securityGroupIDs...)
+
+		// Delete the security group if no instance could be launched with it.
+		defer func() {
+			if err != nil {
+				_ = p.deleteManagedSecurityGroups(ctx, ec2Svc, []string{groupID})
+			}
+		}()
+	}
+
+	for _, market := range markets {
+		for _, instanceType := range instanceTypes {
+			for _, placement := range network.placements {
+				var instance Instance
+				instance, err = p.runInstance(ctx, ec2Svc, input, images[instanceType], instanceType, market, placement, securityGroupIDs)
+				if err == nil {
+					return instance, nil
+				}
+				if !isInsufficientCapacity(err) {
+					return Instance{}, err
+				}
+			}
+		}
+	}
+
+	err = fmt.Errorf("no capacity left in %s: %w", input.Region, err)
+	return Instance{}, err
+}
+
+func (p *AWS) runInstance(ctx context.Context, ec2Svc *ec2.Client, input LaunchInput, image Image, instanceType, market string, placement awsPlacement, securityGroupIDs []string) (Instance, error) {
+	runInput := &ec2.RunInstancesInput{
+		ImageId:      aws.String(image.ID),
+		InstanceType: types.InstanceType(instanceType),
+		MinCount:     aws.Int32(1),
+		MaxCount:     aws.Int32(1),
+		UserData:     aws.String(base64.StdEncoding.EncodeToString([]byte(input.UserData))),
+		DryRun:       aws.Bool(input.DryRun),
+		// Nodes shut themselves down when they are no longer needed, which
+		// would only stop on-demand instances.
+		InstanceInitiatedShutdownBehavior: types.ShutdownBehaviorTerminate,
+		Placement: &types.Placement{
+			AvailabilityZone: aws.String(placement.zone),
+		},
+	}
+
+	if p.StoresSecrets() {
+		runInput.IamInstanceProfile = &types.IamInstanceProfileSpecification{
+			Name: aws.String(awsNodeRoleName),
+		}
+	}
+
+	if placement.subnetID != "" {
+		// Subnets of custom VPCs may not assign public IPs by default.
+		runInput.NetworkInterfaces = []types.InstanceNetworkInterfaceSpecification{
+			{
+				DeviceIndex:              aws.Int32(0),
+				SubnetId:                 aws.String(placement.subnetID),
+				Groups:                   securityGroupIDs,
+				AssociatePublicIpAddress: aws.Bool(true),
+			},
+		}
+	} else if len(securityGroupIDs) > 0 {
+		runInput.SecurityGroupIds = securityGroupIDs
+	}
+
+	if market == MarketSpot {
+		runInput.InstanceMarketOptions = &types.InstanceMarketOptionsRequest{
+			MarketType: types.MarketTypeSpot,
+			SpotOptions: &types.SpotMarketOptions{
+				InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+			},
+		}
+	}
+
+	if len(input.Tags) > 0 {
+		runInput.TagSpecifications = []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeInstance,
+				Tags:         ec2Tags(input.Tags),
+			},
+		}
+	}
+
+	runResult, err := ec2Svc.RunInstances(ctx, runInput)
+	// A new instance profile takes a few seconds to be usable by EC2.
+	for attempt := 1; err != nil && p.StoresSecrets() && isInstanceProfileNotReady(err) && attempt < awsInstanceProfileAttempts; attempt++ {
+		time.Sleep(awsInstanceProfileRetryInterval)
+		runResult, err = ec2Svc.RunInstances(ctx, runInput)
+	}
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create %s %s EC2 instance in %s: %w", market, instanceType, placement.zone, err)
+	}
+
+	if len(runResult.Instances) == 0 {
+		return Instance{}, errors.New("no instances created")
+	}
+
+	return Instance{
+		ID:           *runResult.Instances[0].InstanceId,
+		Region:       input.Region,
+		InstanceType: instanceType,
+		Market:       market,
+	}, nil
+}
+
+// isInsufficientCapacity reports whether RunInstances failed because the
+// requested capacity is not available, and may succeed elsewhere.
+func isInsufficientCapacity(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "InsufficientInstanceCapacity", "SpotMaxPriceTooLow", "MaxSpotInstanceCountExceeded", "InsufficientCapacity", "Unsupported":
+		return true
+	default:
+		return false
+	}
+}
+
+// isInstanceProfileNotReady reports whether RunInstances failed because EC2
+// does not know about the instance profile yet.
+func isInstanceProfileNotReady(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidParameterValue" && strings.Contains(apiErr.ErrorMessage(), "iamInstanceProfile")
+}
+
+func (p *AWS) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2Svc.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{id},
+		Tags:      ec2Tags(tags),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add tags to the instance: %w", err)
+	}
+	return nil
+}
+
+// RegionEndpoint returns the EC2 API endpoint of the region.
+func (p *AWS) RegionEndpoint(region string) string {
+	return "ec2." + region + ".amazonaws.com:443"
+}
+
+// SpotPrice returns the lowest current spot price of the instance type across
+// the availability zones of the region.
+func (p *AWS) SpotPrice(ctx context.Context, region, instanceType string) (float64, error) {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only the current price of every availability zone is returned when
+	// the start time is now.
+	out, err := ec2Svc.DescribeSpotPriceHistory(ctx, &ec2.DescribeSpotPriceHistoryInput{
+		InstanceTypes:       []types.InstanceType{types.InstanceType(instanceType)},
+		ProductDescriptions: []string{"Linux/UNIX"},
+		StartTime:           aws.Time(time.Now()),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe spot prices: %w", err)
+	}
+
+	price := -1.0
+	for _, history := range out.SpotPriceHistory {
+		current, err := strconv.ParseFloat(aws.ToString(history.SpotPrice), 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse spot price: %w", err)
+		}
+		if price < 0 || current < price {
+			price = current
+		}
+	}
+	if price < 0 {
+		return 0, fmt.Errorf("no spot price found for %s in %s", instanceType, region)
+	}
+
+	return price, nil
+}
+
+func (p *AWS) WaitRunning(ctx context.Context, region, id string) error {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	err = ec2.NewInstanceRunningWaiter(ec2Svc).Wait(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{id},
+	}, time.Minute*2)
+	if err != nil {
+		return fmt.Errorf("failed to wait for instance to be running: %w", err)
+	}
+	return nil
+}
+
+func (p *AWS) PublicIP(ctx context.Context, region, id string) (string, error) {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return "", err
+	}
+
+	describeResult, err := ec2Svc.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{id},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe EC2 instance: %w", err)
+	}
+
+	if len(describeResult.Reservations) == 0 {
+		return "", errors.New("no reservations found")
+	}
+
+	reservation := describeResult.Reservations[0]
+	if len(reservation.Instances) == 0 {
+		return "", errors.New("no instances found")
+	}
+
+	instance := reservation.Instances[0]
+	if instance.PublicIpAddress == nil {
+		return "", errors.New("no public IP address found")
+	}
+
+	return *instance.PublicIpAddress, nil
+}
+
+func (p *AWS) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2Svc.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
+		DryRun:      aws.Bool(dryRun),
+		InstanceIds: []string{id},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to terminate instance: %w", err)
+	}
+
+	// The managed security group of the instance cannot be deleted until it
+	// is terminated, it is left to CollectResources.
+	return nil
+}
+
+func (p *AWS) List(ctx context.Context) ([]Instance, error) {
+	regions, err := p.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		instances []Instance
+		errs      []error
+	)
+	for _, region := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			regionInstances, err := p.listRegion(ctx, region)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", region, err))
+				return
+			}
+			instances = append(instances, regionInstances...)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	return instances, nil
+}
+
+func (p *AWS) listRegion(ctx context.Context, region string) ([]Instance, error) {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	paginator := ec2.NewDescribeInstancesPaginator(ec2Svc, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + TagApp),
+				Values: []string{"tailout"},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	})
+
+	instances := []Instance{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe EC2 instances: %w", err)
+		}
+
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				market := MarketOnDemand
+				if instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot {
+					market = MarketSpot
+				}
+
+				tags := make(map[string]string, len(instance.Tags))
+				for _, tag := range instance.Tags {
+					tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+
+				instances = append(instances, Instance{
+					ID:           aws.ToString(instance.InstanceId),
+					Region:       region,
+					PublicIP:     aws.ToString(instance.PublicIpAddress),
+					InstanceType: string(instance.InstanceType),
+					Market:       market,
+					CreatedAt:    aws.ToTime(instance.LaunchTime),
+					Stopped:      instance.State != nil && (instance.State.Name == types.InstanceStateNameStopping || instance.State.Name == types.InstanceStateNameStopped),
+					Tags:         tags,
+				})
+			}
+		}
+	}
+	return instances, nil
+}
+
+func ec2Tags(tags map[string]string) []types.Tag {
+	ec2Tags := make([]types.Tag, 0, len(tags))
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+	return ec2Tags
+}
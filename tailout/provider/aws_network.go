@@ -0,0 +1,301 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// awsManagedTag marks the security groups created by tailout, which are
+// deleted along with the instance using them.
+const awsManagedTag = "tailout:managed"
+
+// awsCreatedAtTag holds the Unix time at which a managed security group was
+// created, so that groups about to be used by a launch are not collected.
+const awsCreatedAtTag = "tailout:created-at"
+
+// awsCollectGracePeriod is how long a managed security group may exist
+// without being used before it is collected.
+const awsCollectGracePeriod = 15 * time.Minute
+
+// awsPlacement is an availability zone an instance can be launched in, with
+// the subnet to use there. An empty subnet means the default subnet of the
+// zone.
+type awsPlacement struct {
+	zone     string
+	subnetID string
+}
+
+// awsNetwork is where instances of a region are launched.
+type awsNetwork struct {
+	vpcID      string
+	placements []awsPlacement
+}
+
+// network resolves the configured subnet or VPC, and falls back to the
+// default VPC of the region.
+func (p *AWS) network(ctx context.Context, ec2Svc *ec2.Client) (awsNetwork, error) {
+	var subnetFilters []types.Filter
+
+	switch {
+	case p.config.SubnetID != "":
+		subnetFilters = []types.Filter{
+			{Name: aws.String("subnet-id"), Values: []string{p.config.SubnetID}},
+		}
+	case len(p.config.VPCTags) > 0:
+		vpcFilters := []types.Filter{}
+		for key, value := range p.config.VPCTags {
+			vpcFilters = append(vpcFilters, types.Filter{Name: aws.String("tag:" + key), Values: []string{value}})
+		}
+
+		vpcs, err := ec2Svc.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{Filters: vpcFilters})
+		if err != nil {
+			return awsNetwork{}, fmt.Errorf("failed to describe VPCs: %w", err)
+		}
+		if len(vpcs.Vpcs) != 1 {
+			return awsNetwork{}, fmt.Errorf("expected one VPC matching the configured tags, found %d", len(vpcs.Vpcs))
+		}
+
+		subnetFilters = []types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{*vpcs.Vpcs[0].VpcId}},
+			{Name: aws.String("state"), Values: []string{"available"}},
+		}
+	default:
+		zones, err := ec2Svc.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+			Filters: []types.Filter{
+				{Name: aws.String("state"), Values: []string{"available"}},
+				{Name: aws.String("zone-type"), Values: []string{"availability-zone"}},
+			},
+		})
+		if err != nil {
+			return awsNetwork{}, fmt.Errorf("failed to describe availability zones: %w", err)
+		}
+
+		network := awsNetwork{}
+		for _, zone := range zones.AvailabilityZones {
+			network.placements = append(network.placements, awsPlacement{zone: *zone.ZoneName})
+		}
+
+		if p.config.ManagedSecurityGroup {
+			vpcs, err := ec2Svc.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+				Filters: []types.Filter{
+					{Name: aws.String("is-default"), Values: []string{"true"}},
+				},
+			})
+			if err != nil {
+				return awsNetwork{}, fmt.Errorf("failed to describe VPCs: %w", err)
+			}
+			if len(vpcs.Vpcs) == 0 {
+				return awsNetwork{}, errors.New("no default VPC found, configure a subnet or VPC tags")
+			}
+			network.vpcID = *vpcs.Vpcs[0].VpcId
+		}
+
+		return network, nil
+	}
+
+	subnets, err := ec2Svc.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{Filters: subnetFilters})
+	if err != nil {
+		return awsNetwork{}, fmt.Errorf("failed to describe subnets: %w", err)
+	}
+	if len(subnets.Subnets) == 0 {
+		return awsNetwork{}, errors.New("no subnet found for the configured network")
+	}
+
+	network := awsNetwork{vpcID: *subnets.Subnets[0].VpcId}
+	for _, subnet := range subnets.Subnets {
+		network.placements = append(network.placements, awsPlacement{
+			zone:     *subnet.AvailabilityZone,
+			subnetID: *subnet.SubnetId,
+		})
+	}
+
+	return network, nil
+}
+
+// createSecurityGroup creates a security group allowing all outbound
+// traffic, and inbound traffic on the WireGuard port used by tailscale for
+// direct connections.
+func (p *AWS) createSecurityGroup(ctx context.Context, ec2Svc *ec2.Client, vpcID string, tags map[string]string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate security group name: %w", err)
+	}
+
+	groupTags := map[string]string{
+		awsManagedTag:   "true",
+		awsCreatedAtTag: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	for key, value := range tags {
+		groupTags[key] = value
+	}
+
+	group, err := ec2Svc.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String("tailout-" + hex.EncodeToString(suffix)),
+		Description: aws.String("tailout exit node"),
+		VpcId:       aws.String(vpcID),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeSecurityGroup,
+				Tags:         ec2Tags(groupTags),
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create security group: %w", err)
+	}
+
+	// Security groups allow all outbound traffic by default.
+	_, err = ec2Svc.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId: group.GroupId,
+		IpPermissions: []types.IpPermission{
+			{
+				IpProtocol: aws.String("udp"),
+				FromPort:   aws.Int32(41641),
+				ToPort:     aws.Int32(41641),
+				IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+				Ipv6Ranges: []types.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+			},
+		},
+	})
+	if err != nil {
+		return *group.GroupId, fmt.Errorf("failed to authorize tailscale traffic: %w", err)
+	}
+
+	return *group.GroupId, nil
+}
+
+// deleteManagedSecurityGroups deletes the security groups created by tailout
+// among groupIDs, which no instance must be using.
+func (p *AWS) deleteManagedSecurityGroups(ctx context.Context, ec2Svc *ec2.Client, groupIDs []string) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	groups, err := ec2Svc.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		GroupIds: groupIDs,
+		Filters: []types.Filter{
+			{Name: aws.String("tag:" + awsManagedTag), Values: []string{"true"}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	if len(groups.SecurityGroups) == 0 {
+		return nil
+	}
+
+	for _, group := range groups.SecurityGroups {
+		_, err := ec2Svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
+			GroupId: group.GroupId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete security group %s: %w", *group.GroupId, err)
+		}
+	}
+
+	return nil
+}
+
+// CollectResources deletes the managed security groups of every region that
+// no network interface uses anymore, which are left behind by terminated
+// instances.
+func (p *AWS) CollectResources(ctx context.Context, dryRun bool) ([]string, error) {
+	regions, err := p.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		collected []string
+		errs      []error
+	)
+	for _, region := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			groupIDs, err := p.collectSecurityGroups(ctx, region, dryRun)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, groupID := range groupIDs {
+				collected = append(collected, "security group "+groupID+" in "+region)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			}
+		}()
+	}
+	wg.Wait()
+
+	return collected, errors.Join(errs...)
+}
+
+// collectSecurityGroups deletes the unused managed security groups of a
+// region and returns their IDs.
+func (p *AWS) collectSecurityGroups(ctx context.Context, region string, dryRun bool) ([]string, error) {
+	ec2Svc, err := p.ec2Client(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := ec2Svc.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:" + awsManagedTag), Values: []string{"true"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe security groups: %w", err)
+	}
+
+	collected := []string{}
+	for _, group := range groups.SecurityGroups {
+		tooRecent := false
+		for _, tag := range group.Tags {
+			if aws.ToString(tag.Key) != awsCreatedAtTag {
+				continue
+			}
+			if seconds, err := strconv.ParseInt(aws.ToString(tag.Value), 10, 64); err == nil {
+				tooRecent = time.Since(time.Unix(seconds, 0)) < awsCollectGracePeriod
+			}
+		}
+		if tooRecent {
+			continue
+		}
+
+		interfaces, err := ec2Svc.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+			Filters: []types.Filter{
+				{Name: aws.String("group-id"), Values: []string{aws.ToString(group.GroupId)}},
+			},
+		})
+		if err != nil {
+			return collected, fmt.Errorf("failed to describe network interfaces of security group %s: %w", aws.ToString(group.GroupId), err)
+		}
+		if len(interfaces.NetworkInterfaces) > 0 {
+			continue
+		}
+
+		if !dryRun {
+			_, err := ec2Svc.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
+				GroupId: group.GroupId,
+			})
+			if err != nil {
+				return collected, fmt.Errorf("failed to delete security group %s: %w", aws.ToString(group.GroupId), err)
+			}
+		}
+		collected = append(collected, aws.ToString(group.GroupId))
+	}
+
+	return collected, nil
+}
@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Services the auth key can be stored in, instead of the user data.
+const (
+	AWSSecretStoreSSM            = "ssm"
+	AWSSecretStoreSecretsManager = "secretsmanager"
+)
+
+const (
+	awsSecretPrefix       = "tailout/auth-keys/"
+	awsNodeRoleName       = "tailout-node"
+	awsNodeRolePolicyName = "tailout-auth-keys"
+
+	// Launches are retried for up to a minute while EC2 does not know about
+	// a new instance profile.
+	awsInstanceProfileAttempts      = 12
+	awsInstanceProfileRetryInterval = 5 * time.Second
+)
+
+func (p *AWS) StoresSecrets() bool {
+	return p.config.AuthKeyStore != ""
+}
+
+// StoreSecret writes value to a SecureString SSM parameter or to a Secrets
+// Manager secret, that instances launched afterwards can read through the
+// tailout-node instance profile.
+func (p *AWS) StoreSecret(ctx context.Context, region, value string) (Secret, error) {
+	cfg, err := p.loadConfig(ctx, region)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	if err := p.ensureNodeInstanceProfile(ctx); err != nil {
+		return Secret{}, err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return Secret{}, fmt.Errorf("failed to generate secret name: %w", err)
+	}
+	name := awsSecretPrefix + hex.EncodeToString(suffix)
+
+	switch p.config.AuthKeyStore {
+	case AWSSecretStoreSSM:
+		name = "/" + name
+		_, err = ssm.NewFromConfig(cfg).PutParameter(ctx, &ssm.PutParameterInput{
+			Name:        aws.String(name),
+			Value:       aws.String(value),
+			Type:        ssmtypes.ParameterTypeSecureString,
+			Description: aws.String("tailout exit node auth key"),
+		})
+		if err != nil {
+			return Secret{}, fmt.Errorf("failed to put SSM parameter: %w", err)
+		}
+
+		return Secret{
+			ID: name,
+			// Credentials of the instance profile may take a few seconds to
+			// be available after boot, so the fetch is retried.
+			Script: fmt.Sprintf(`until AUTH_KEY=$(aws ssm get-parameter --region %s --name %s --with-decryption --query Parameter.Value --output text); do sleep 2; done`, region, name),
+		}, nil
+	case AWSSecretStoreSecretsManager:
+		_, err = secretsmanager.NewFromConfig(cfg).CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+			Name:         aws.String(name),
+			SecretString: aws.String(value),
+			Description:  aws.String("tailout exit node auth key"),
+		})
+		if err != nil {
+			return Secret{}, fmt.Errorf("failed to create secret: %w", err)
+		}
+
+		return Secret{
+			ID: name,
+			// The fetch is retried until the instance profile credentials
+			// are available.
+			Script: fmt.Sprintf(`until AUTH_KEY=$(aws secretsmanager get-secret-value --region %s --secret-id %s --query SecretString --output text); do sleep 2; done`, region, name),
+		}, nil
+	default:
+		return Secret{}, fmt.Errorf("unknown auth key store %q, must be %s or %s", p.config.AuthKeyStore, AWSSecretStoreSSM, AWSSecretStoreSecretsManager)
+	}
+}
+
+func (p *AWS) DeleteSecret(ctx context.Context, region string, secret Secret) error {
+	cfg, err := p.loadConfig(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	switch p.config.AuthKeyStore {
+	case AWSSecretStoreSSM:
+		_, err = ssm.NewFromConfig(cfg).DeleteParameter(ctx, &ssm.DeleteParameterInput{
+			Name: aws.String(secret.ID),
+		})
+		var notFound *ssmtypes.ParameterNotFound
+		if err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("failed to delete SSM parameter: %w", err)
+		}
+	case AWSSecretStoreSecretsManager:
+		_, err = secretsmanager.NewFromConfig(cfg).DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+			SecretId:                   aws.String(secret.ID),
+			ForceDeleteWithoutRecovery: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete secret: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ensureNodeInstanceProfile creates the tailout-node instance profile and
+// its role, unless the profile already exists with the role attached, so that
+// it completes an earlier run that failed halfway. The role can only read the
+// auth keys stored by tailout.
+func (p *AWS) ensureNodeInstanceProfile(ctx context.Context) error {
+	cfg, err := p.loadConfig(ctx, "us-east-1")
+	if err != nil {
+		return err
+	}
+	iamSvc := iam.NewFromConfig(cfg)
+
+	profile, err := iamSvc.GetInstanceProfile(ctx, &iam.GetInstanceProfileInput{
+		InstanceProfileName: aws.String(awsNodeRoleName),
+	})
+	var noSuchEntity *iamtypes.NoSuchEntityException
+	if err == nil {
+		hasRole := slices.ContainsFunc(profile.InstanceProfile.Roles, func(role iamtypes.Role) bool {
+			return aws.ToString(role.RoleName) == awsNodeRoleName
+		})
+		if hasRole {
+			return nil
+		}
+	} else if !errors.As(err, &noSuchEntity) {
+		return fmt.Errorf("failed to get instance profile: %w", err)
+	}
+
+	_, err = iamSvc.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:    aws.String(awsNodeRoleName),
+		Description: aws.String("Lets tailout exit nodes read their auth key"),
+		AssumeRolePolicyDocument: aws.String(`{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "ec2.amazonaws.com"},
+    "Action": "sts:AssumeRole"
+  }]
+}`),
+		Tags: []iamtypes.Tag{{Key: aws.String("App"), Value: aws.String("tailout")}},
+	})
+	var alreadyExists *iamtypes.EntityAlreadyExistsException
+	if err != nil && !errors.As(err, &alreadyExists) {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	_, err = iamSvc.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:   aws.String(awsNodeRoleName),
+		PolicyName: aws.String(awsNodeRolePolicyName),
+		PolicyDocument: aws.String(`{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": "ssm:GetParameter",
+      "Resource": "arn:aws:ssm:*:*:parameter/` + awsSecretPrefix + `*"
+    },
+    {
+      "Effect": "Allow",
+      "Action": "secretsmanager:GetSecretValue",
+      "Resource": "arn:aws:secretsmanager:*:*:secret:` + awsSecretPrefix + `*"
+    }
+  ]
+}`),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put role policy: %w", err)
+	}
+
+	_, err = iamSvc.CreateInstanceProfile(ctx, &iam.CreateInstanceProfileInput{
+		InstanceProfileName: aws.String(awsNodeRoleName),
+	})
+	if err != nil && !errors.As(err, &alreadyExists) {
+		return fmt.Errorf("failed to create instance profile: %w", err)
+	}
+
+	_, err = iamSvc.AddRoleToInstanceProfile(ctx, &iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: aws.String(awsNodeRoleName),
+		RoleName:            aws.String(awsNodeRoleName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add role to instance profile: %w", err)
+	}
+
+	return nil
+}
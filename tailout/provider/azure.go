@@ -0,0 +1,533 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/internal/rest"
+	"github.com/cterence/tailout/tailout/config"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	azureBaseURL              = "https://management.azure.com"
+	azureComputeAPIVersion    = "2024-03-01"
+	azureNetworkAPIVersion    = "2023-09-01"
+	azureResourcesAPIVersion  = "2021-04-01"
+	azureDefaultResourceGroup = "tailout"
+)
+
+// Azure launches exit nodes as Spot VMs in a resource group dedicated to
+// tailout. Regions are Azure locations.
+//
+// The ID of an instance is the random suffix of its resources names: the VM
+// tailout-<id> uses the NIC tailout-<id>-nic, the public IP tailout-<id>-ip and
+// the OS disk tailout-<id>-osdisk.
+type Azure struct {
+	config config.AzureConfig
+	api    *rest.Client
+}
+
+func NewAzure(c config.AzureConfig) *Azure {
+	for value, env := range map[*string]string{
+		&c.SubscriptionID: "AZURE_SUBSCRIPTION_ID",
+		&c.TenantID:       "AZURE_TENANT_ID",
+		&c.ClientID:       "AZURE_CLIENT_ID",
+		&c.ClientSecret:   "AZURE_CLIENT_SECRET",
+	} {
+		if *value == "" {
+			*value = os.Getenv(env)
+		}
+	}
+
+	if c.ResourceGroup == "" {
+		c.ResourceGroup = azureDefaultResourceGroup
+	}
+
+	return &Azure{
+		config: c,
+	}
+}
+
+func (p *Azure) Name() string {
+	return "azure"
+}
+
+// client lazily authenticates with the configured service principal.
+func (p *Azure) client(ctx context.Context) (*rest.Client, error) {
+	if p.api != nil {
+		return p.api, nil
+	}
+
+	if p.config.SubscriptionID == "" || p.config.TenantID == "" || p.config.ClientID == "" || p.config.ClientSecret == "" {
+		return nil, errors.New("incomplete Azure configuration, azure.subscription_id, azure.tenant_id, azure.client_id and azure.client_secret are required")
+	}
+
+	credentials := &clientcredentials.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		TokenURL:     "https://login.microsoftonline.com/" + p.config.TenantID + "/oauth2/v2.0/token",
+		Scopes:       []string{azureBaseURL + "/.default"},
+	}
+
+	p.api = &rest.Client{
+		HTTPClient: credentials.Client(ctx),
+		BaseURL:    azureBaseURL + "/subscriptions/" + p.config.SubscriptionID,
+	}
+	return p.api, nil
+}
+
+func (p *Azure) resourcePath(provider, kind, name, apiVersion string) string {
+	return fmt.Sprintf("/resourceGroups/%s/providers/%s/%s/%s?api-version=%s", p.config.ResourceGroup, provider, kind, name, apiVersion)
+}
+
+func (p *Azure) vmPath(id string) string {
+	return p.resourcePath("Microsoft.Compute", "virtualMachines", "tailout-"+id, azureComputeAPIVersion)
+}
+
+func (p *Azure) nicPath(id string) string {
+	return p.resourcePath("Microsoft.Network", "networkInterfaces", "tailout-"+id+"-nic", azureNetworkAPIVersion)
+}
+
+func (p *Azure) publicIPPath(id string) string {
+	return p.resourcePath("Microsoft.Network", "publicIPAddresses", "tailout-"+id+"-ip", azureNetworkAPIVersion)
+}
+
+func (p *Azure) diskPath(id string) string {
+	return p.resourcePath("Microsoft.Compute", "disks", "tailout-"+id+"-osdisk", azureComputeAPIVersion)
+}
+
+func (p *Azure) vnetPath(region string) string {
+	return p.resourcePath("Microsoft.Network", "virtualNetworks", "tailout-"+region, azureNetworkAPIVersion)
+}
+
+func (p *Azure) Account(ctx context.Context) (string, error) {
+	if _, err := p.client(ctx); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Azure subscription %s (resource group %s)", p.config.SubscriptionID, p.config.ResourceGroup), nil
+}
+
+func (p *Azure) Regions(ctx context.Context) ([]string, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Value []struct {
+			Name     string `json:"name"`
+			Metadata struct {
+				RegionType string `json:"regionType"`
+			} `json:"metadata"`
+		} `json:"value"`
+	}
+	if err := api.Do(ctx, http.MethodGet, "/locations?api-version=2022-12-01", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+
+	regionNames := []string{}
+	for _, location := range result.Value {
+		if location.Metadata.RegionType == "Physical" {
+			regionNames = append(regionNames, location.Name)
+		}
+	}
+
+	return regionNames, nil
+}
+
+// DefaultInstanceType returns the smallest AMD size available as a Spot VM,
+// burstable B-series sizes are not.
+func (p *Azure) DefaultInstanceType() string {
+	return "Standard_D2as_v5"
+}
+
+func (p *Azure) FindImage(ctx context.Context, region, instanceType string) (Image, error) {
+	return Image{
+		ID:   "Debian:debian-12:12-gen2:latest",
+		Name: "Debian 12",
+	}, nil
+}
+
+func (p *Azure) SetupScript() string {
+	return `apt-get update && apt-get install -y at
+VM_NAME=$(curl -sSL -H "Metadata: true" "http://169.254.169.254/metadata/instance/compute/name?api-version=2021-02-01&format=text")
+INSTANCE_ID=${VM_NAME#tailout-}`
+}
+
+// Launch creates the resource group and the virtual network of the region
+// if needed, then the public IP, NIC and VM of the instance. The resources of
+// the instance are deleted if one of them fails to be created.
+func (p *Azure) Launch(ctx context.Context, input LaunchInput) (_ Instance, err error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	if input.DryRun {
+		return Instance{}, ErrDryRun
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Instance{}, fmt.Errorf("failed to generate instance ID: %w", err)
+	}
+	id := hex.EncodeToString(suffix)
+
+	// Tailscale SSH is used to log into nodes, the password is never used.
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		return Instance{}, fmt.Errorf("failed to generate admin password: %w", err)
+	}
+
+	// The location of an existing resource group cannot be changed, and it
+	// may hold resources of any location.
+	resourceGroupPath := "/resourcegroups/" + p.config.ResourceGroup + "?api-version=" + azureResourcesAPIVersion
+	err = api.Do(ctx, http.MethodGet, resourceGroupPath, nil, nil)
+	if rest.IsNotFound(err) {
+		err = api.Do(ctx, http.MethodPut, resourceGroupPath, map[string]any{
+			"location": input.Region,
+			"tags":     map[string]string{"App": "tailout"},
+		}, nil)
+	}
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create resource group: %w", err)
+	}
+
+	err = p.putAndWait(ctx, p.vnetPath(input.Region), map[string]any{
+		"location": input.Region,
+		"tags":     input.Tags,
+		"properties": map[string]any{
+			"addressSpace": map[string]any{"addressPrefixes": []string{"10.0.0.0/16"}},
+			"subnets": []map[string]any{
+				{"name": "default", "properties": map[string]any{"addressPrefix": "10.0.0.0/24"}},
+			},
+		},
+	})
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create virtual network: %w", err)
+	}
+
+	// Without their VM, the public IP and NIC are billed but not listed.
+	defer func() {
+		if err == nil {
+			return
+		}
+		if terminateErr := p.Terminate(ctx, input.Region, id, false); terminateErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete the resources of the instance: %w", terminateErr))
+		}
+	}()
+
+	var publicIP azureResource
+	err = p.putAndWait(ctx, p.publicIPPath(id), map[string]any{
+		"location": input.Region,
+		"tags":     input.Tags,
+		"sku":      map[string]string{"name": "Standard"},
+		"properties": map[string]any{
+			"publicIPAllocationMethod": "Static",
+		},
+	}, &publicIP)
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create public IP: %w", err)
+	}
+
+	var nic azureResource
+	err = p.putAndWait(ctx, p.nicPath(id), map[string]any{
+		"location": input.Region,
+		"tags":     input.Tags,
+		"properties": map[string]any{
+			"enableIPForwarding": true,
+			"ipConfigurations": []map[string]any{
+				{
+					"name": "ipconfig",
+					"properties": map[string]any{
+						"subnet": map[string]string{"id": "/subscriptions/" + p.config.SubscriptionID + "/resourceGroups/" + p.config.ResourceGroup + "/providers/Microsoft.Network/virtualNetworks/tailout-" + input.Region + "/subnets/default"},
+						// The public IP is deleted with the NIC, itself deleted
+						// with the VM, when a Spot VM is evicted.
+						"publicIPAddress": map[string]any{
+							"id":         publicIP.ID,
+							"properties": map[string]string{"deleteOption": "Delete"},
+						},
+					},
+				},
+			},
+		},
+	}, &nic)
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create network interface: %w", err)
+	}
+
+	// Image IDs are URNs, as used by the Azure CLI.
+	urn := strings.Split(input.Image.ID, ":")
+	if len(urn) != 4 {
+		return Instance{}, fmt.Errorf("invalid image URN %q", input.Image.ID)
+	}
+
+	err = api.Do(ctx, http.MethodPut, p.vmPath(id), map[string]any{
+		"location": input.Region,
+		"tags":     input.Tags,
+		"properties": map[string]any{
+			"priority":       "Spot",
+			"evictionPolicy": "Delete",
+			"billingProfile": map[string]any{"maxPrice": -1},
+			"hardwareProfile": map[string]string{
+				"vmSize": input.InstanceType,
+			},
+			"storageProfile": map[string]any{
+				"imageReference": map[string]string{
+					"publisher": urn[0],
+					"offer":     urn[1],
+					"sku":       urn[2],
+					"version":   urn[3],
+				},
+				"osDisk": map[string]any{
+					"name":         "tailout-" + id + "-osdisk",
+					"createOption": "FromImage",
+					"deleteOption": "Delete",
+					"managedDisk":  map[string]string{"storageAccountType": "Standard_LRS"},
+				},
+			},
+			"osProfile": map[string]any{
+				"computerName":  "tailout-" + id,
+				"adminUsername": "tailout",
+				"adminPassword": base64.RawURLEncoding.EncodeToString(password) + "Aa1!",
+				"customData":    base64.StdEncoding.EncodeToString([]byte(input.UserData)),
+			},
+			"networkProfile": map[string]any{
+				"networkInterfaces": []map[string]any{
+					{"id": nic.ID, "properties": map[string]string{"deleteOption": "Delete"}},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create virtual machine: %w", err)
+	}
+
+	return Instance{
+		ID:     id,
+		Region: input.Region,
+	}, nil
+}
+
+type azureResource struct {
+	ID         string            `json:"id"`
+	Tags       map[string]string `json:"tags"`
+	Properties struct {
+		ProvisioningState string `json:"provisioningState"`
+		IPAddress         string `json:"ipAddress"`
+	} `json:"properties"`
+}
+
+// putAndWait creates or updates a resource and waits for its provisioning to
+// complete, since Azure provisions most resources asynchronously.
+func (p *Azure) putAndWait(ctx context.Context, path string, body any, out ...*azureResource) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := api.Do(ctx, http.MethodPut, path, body, nil); err != nil {
+		return err
+	}
+
+	return poll(ctx, 2*time.Minute, 2*time.Second, func() (bool, error) {
+		var resource azureResource
+		if err := api.Do(ctx, http.MethodGet, path, nil, &resource); err != nil {
+			return false, err
+		}
+
+		switch resource.Properties.ProvisioningState {
+		case "Succeeded":
+			for _, o := range out {
+				*o = resource
+			}
+			return true, nil
+		case "Failed", "Canceled":
+			return false, fmt.Errorf("provisioning %s", resource.Properties.ProvisioningState)
+		default:
+			return false, nil
+		}
+	})
+}
+
+// deleteAndWait deletes a resource if it exists and waits until it is gone.
+func (p *Azure) deleteAndWait(ctx context.Context, path string) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := api.Do(ctx, http.MethodDelete, path, nil, nil); err != nil {
+		if rest.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	return poll(ctx, 5*time.Minute, 5*time.Second, func() (bool, error) {
+		err := api.Do(ctx, http.MethodGet, path, nil, nil)
+		if rest.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+// Tag merges tags into the tags of the VM.
+func (p *Azure) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/tailout-%s/providers/Microsoft.Resources/tags/default?api-version=%s", p.config.ResourceGroup, id, azureResourcesAPIVersion)
+	err = api.Do(ctx, http.MethodPatch, path, map[string]any{
+		"operation":  "Merge",
+		"properties": map[string]any{"tags": tags},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add tags to the virtual machine: %w", err)
+	}
+	return nil
+}
+
+func (p *Azure) WaitRunning(ctx context.Context, region, id string) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/tailout-%s/instanceView?api-version=%s", p.config.ResourceGroup, id, azureComputeAPIVersion)
+	return poll(ctx, 5*time.Minute, 5*time.Second, func() (bool, error) {
+		var instanceView struct {
+			Statuses []struct {
+				Code string `json:"code"`
+			} `json:"statuses"`
+		}
+		if err := api.Do(ctx, http.MethodGet, path, nil, &instanceView); err != nil {
+			return false, err
+		}
+
+		for _, status := range instanceView.Statuses {
+			if status.Code == "PowerState/running" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+func (p *Azure) PublicIP(ctx context.Context, region, id string) (string, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var publicIP azureResource
+	if err := api.Do(ctx, http.MethodGet, p.publicIPPath(id), nil, &publicIP); err != nil {
+		return "", fmt.Errorf("failed to describe public IP: %w", err)
+	}
+
+	if publicIP.Properties.IPAddress == "" {
+		return "", errors.New("no public IP address found")
+	}
+
+	return publicIP.Properties.IPAddress, nil
+}
+
+// Terminate deletes the VM, then its NIC, public IP and OS disk in case they
+// were not deleted along with it.
+func (p *Azure) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	if _, err := p.client(ctx); err != nil {
+		return err
+	}
+
+	if dryRun {
+		return ErrDryRun
+	}
+
+	for _, resource := range []struct {
+		name string
+		path string
+	}{
+		{"virtual machine", p.vmPath(id)},
+		{"network interface", p.nicPath(id)},
+		{"public IP", p.publicIPPath(id)},
+		{"disk", p.diskPath(id)},
+	} {
+		if err := p.deleteAndWait(ctx, resource.path); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", resource.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Azure) List(ctx context.Context) ([]Instance, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Value []struct {
+			Name       string            `json:"name"`
+			Location   string            `json:"location"`
+			Tags       map[string]string `json:"tags"`
+			Properties struct {
+				TimeCreated  time.Time `json:"timeCreated"`
+				InstanceView struct {
+					Statuses []struct {
+						Code string `json:"code"`
+					} `json:"statuses"`
+				} `json:"instanceView"`
+				HardwareProfile struct {
+					VMSize string `json:"vmSize"`
+				} `json:"hardwareProfile"`
+			} `json:"properties"`
+		} `json:"value"`
+	}
+	path := fmt.Sprintf("/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines?$expand=instanceView&api-version=%s", p.config.ResourceGroup, azureComputeAPIVersion)
+	if err := api.Do(ctx, http.MethodGet, path, nil, &result); err != nil {
+		// Nothing was ever launched if the resource group does not exist.
+		if rest.IsNotFound(err) {
+			return []Instance{}, nil
+		}
+		return nil, fmt.Errorf("failed to list virtual machines: %w", err)
+	}
+
+	instances := []Instance{}
+	for _, vm := range result.Value {
+		if vm.Tags[TagApp] != "tailout" {
+			continue
+		}
+		// VMs shut down from the inside are stopped but still billed, and
+		// deallocated ones keep their disk and public IP.
+		stopped := false
+		for _, status := range vm.Properties.InstanceView.Statuses {
+			switch status.Code {
+			case "PowerState/stopping", "PowerState/stopped", "PowerState/deallocating", "PowerState/deallocated":
+				stopped = true
+			}
+		}
+		instances = append(instances, Instance{
+			ID:           strings.TrimPrefix(vm.Name, "tailout-"),
+			Region:       vm.Location,
+			InstanceType: vm.Properties.HardwareProfile.VMSize,
+			Market:       MarketSpot,
+			CreatedAt:    vm.Properties.TimeCreated,
+			Stopped:      stopped,
+			Tags:         vm.Tags,
+		})
+	}
+	return instances, nil
+}
@@ -0,0 +1,307 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/internal/rest"
+	"github.com/cterence/tailout/tailout/config"
+)
+
+const digitalOceanBaseURL = "https://api.digitalocean.com/v2"
+
+// DigitalOcean launches exit nodes as DigitalOcean droplets. Regions are
+// DigitalOcean region slugs.
+type DigitalOcean struct {
+	api *rest.Client
+}
+
+func NewDigitalOcean(c config.DigitalOceanConfig) *DigitalOcean {
+	token := c.Token
+	if token == "" {
+		token = os.Getenv("DIGITALOCEAN_TOKEN")
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = digitalOceanBaseURL
+	}
+
+	return &DigitalOcean{
+		api: &rest.Client{
+			BaseURL: endpoint,
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + token},
+			},
+		},
+	}
+}
+
+func (p *DigitalOcean) Name() string {
+	return "digitalocean"
+}
+
+func (p *DigitalOcean) Account(ctx context.Context) (string, error) {
+	var result struct {
+		Account struct {
+			Email string `json:"email"`
+		} `json:"account"`
+	}
+	if err := p.api.Do(ctx, http.MethodGet, "/account", nil, &result); err != nil {
+		return "", fmt.Errorf("failed to get account: %w", err)
+	}
+	return "DigitalOcean account " + result.Account.Email, nil
+}
+
+func (p *DigitalOcean) Regions(ctx context.Context) ([]string, error) {
+	var result struct {
+		Regions []struct {
+			Slug      string `json:"slug"`
+			Available bool   `json:"available"`
+		} `json:"regions"`
+	}
+	if err := p.api.Do(ctx, http.MethodGet, "/regions?per_page=200", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to list regions: %w", err)
+	}
+
+	regionNames := []string{}
+	for _, region := range result.Regions {
+		if region.Available {
+			regionNames = append(regionNames, region.Slug)
+		}
+	}
+
+	return regionNames, nil
+}
+
+// RegionEndpoint returns the speed test server of the region.
+func (p *DigitalOcean) RegionEndpoint(region string) string {
+	return "speedtest-" + region + ".digitalocean.com:443"
+}
+
+func (p *DigitalOcean) DefaultInstanceType() string {
+	return "s-1vcpu-512mb-10gb"
+}
+
+func (p *DigitalOcean) FindImage(ctx context.Context, region, instanceType string) (Image, error) {
+	var result struct {
+		Image struct {
+			ID   int64  `json:"id"`
+			Slug string `json:"slug"`
+			Name string `json:"name"`
+		} `json:"image"`
+	}
+	if err := p.api.Do(ctx, http.MethodGet, "/images/debian-12-x64", nil, &result); err != nil {
+		return Image{}, fmt.Errorf("failed to get Debian image: %w", err)
+	}
+
+	return Image{
+		ID:   result.Image.Slug,
+		Name: result.Image.Name,
+	}, nil
+}
+
+func (p *DigitalOcean) SetupScript() string {
+	return `apt-get update && apt-get install -y at
+INSTANCE_ID=$(curl -sSL http://169.254.169.254/metadata/v1/id)`
+}
+
+func (p *DigitalOcean) Launch(ctx context.Context, input LaunchInput) (Instance, error) {
+	if input.DryRun {
+		return Instance{}, ErrDryRun
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Instance{}, fmt.Errorf("failed to generate droplet name: %w", err)
+	}
+
+	var result struct {
+		Droplet digitalOceanDroplet `json:"droplet"`
+	}
+	err := p.api.Do(ctx, http.MethodPost, "/droplets", map[string]any{
+		"name":      "tailout-" + hex.EncodeToString(suffix),
+		"region":    input.Region,
+		"size":      input.InstanceType,
+		"image":     input.Image.ID,
+		"user_data": input.UserData,
+		"ipv6":      true,
+		"tags":      append([]string{"tailout"}, digitalOceanTags(input.Tags)...),
+	}, &result)
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create droplet: %w", err)
+	}
+
+	return Instance{
+		ID:     strconv.FormatInt(result.Droplet.ID, 10),
+		Region: input.Region,
+	}, nil
+}
+
+type digitalOceanDroplet struct {
+	ID        int64     `json:"id"`
+	Status    string    `json:"status"`
+	Tags      []string  `json:"tags"`
+	SizeSlug  string    `json:"size_slug"`
+	CreatedAt time.Time `json:"created_at"`
+	Region    struct {
+		Slug string `json:"slug"`
+	} `json:"region"`
+	Networks struct {
+		V4 []struct {
+			IPAddress string `json:"ip_address"`
+			Type      string `json:"type"`
+		} `json:"v4"`
+	} `json:"networks"`
+}
+
+func (p *DigitalOcean) get(ctx context.Context, id string) (digitalOceanDroplet, error) {
+	var result struct {
+		Droplet digitalOceanDroplet `json:"droplet"`
+	}
+	if err := p.api.Do(ctx, http.MethodGet, "/droplets/"+id, nil, &result); err != nil {
+		return digitalOceanDroplet{}, fmt.Errorf("failed to describe droplet: %w", err)
+	}
+	return result.Droplet, nil
+}
+
+// Tag replaces the droplet tags holding the same keys as tags. DigitalOcean
+// tags are plain strings, so each tag is stored as "key:value".
+func (p *DigitalOcean) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	droplet, err := p.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]any{
+		"resources": []map[string]string{
+			{"resource_id": id, "resource_type": "droplet"},
+		},
+	}
+
+	newTags := digitalOceanTags(tags)
+	for _, existing := range droplet.Tags {
+		for _, tag := range newTags {
+			key, _, _ := strings.Cut(tag, ":")
+			if existing != tag && strings.HasPrefix(existing, key+":") {
+				if err := p.api.Do(ctx, http.MethodDelete, "/tags/"+existing+"/resources", resources, nil); err != nil {
+					return fmt.Errorf("failed to remove tag %s from the droplet: %w", existing, err)
+				}
+			}
+		}
+	}
+
+	for _, tag := range newTags {
+		if err := p.api.Do(ctx, http.MethodPost, "/tags", map[string]string{"name": tag}, nil); err != nil {
+			return fmt.Errorf("failed to create tag %s: %w", tag, err)
+		}
+		if err := p.api.Do(ctx, http.MethodPost, "/tags/"+tag+"/resources", resources, nil); err != nil {
+			return fmt.Errorf("failed to add tag %s to the droplet: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *DigitalOcean) WaitRunning(ctx context.Context, region, id string) error {
+	return poll(ctx, 2*time.Minute, 5*time.Second, func() (bool, error) {
+		droplet, err := p.get(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		return droplet.Status == "active", nil
+	})
+}
+
+func (p *DigitalOcean) PublicIP(ctx context.Context, region, id string) (string, error) {
+	droplet, err := p.get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if publicIP := droplet.publicIP(); publicIP != "" {
+		return publicIP, nil
+	}
+	return "", errors.New("no public IP address found")
+}
+
+func (d digitalOceanDroplet) publicIP() string {
+	for _, network := range d.Networks.V4 {
+		if network.Type == "public" {
+			return network.IPAddress
+		}
+	}
+	return ""
+}
+
+func (p *DigitalOcean) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	if dryRun {
+		return ErrDryRun
+	}
+
+	if err := p.api.Do(ctx, http.MethodDelete, "/droplets/"+id, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete droplet: %w", err)
+	}
+	return nil
+}
+
+func (p *DigitalOcean) List(ctx context.Context) ([]Instance, error) {
+	instances := []Instance{}
+	for page := 1; ; page++ {
+		var result struct {
+			Droplets []digitalOceanDroplet `json:"droplets"`
+			Links    struct {
+				Pages struct {
+					Next string `json:"next"`
+				} `json:"pages"`
+			} `json:"links"`
+		}
+		err := p.api.Do(ctx, http.MethodGet, "/droplets?tag_name=tailout&per_page=200&page="+strconv.Itoa(page), nil, &result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list droplets: %w", err)
+		}
+
+		for _, droplet := range result.Droplets {
+			// Tags are stored as "key:value", see digitalOceanTags.
+			tags := map[string]string{}
+			for _, tag := range droplet.Tags {
+				if key, value, ok := strings.Cut(tag, ":"); ok {
+					tags[key] = value
+				}
+			}
+
+			instances = append(instances, Instance{
+				ID:           strconv.FormatInt(droplet.ID, 10),
+				Region:       droplet.Region.Slug,
+				PublicIP:     droplet.publicIP(),
+				InstanceType: droplet.SizeSlug,
+				Market:       MarketOnDemand,
+				CreatedAt:    droplet.CreatedAt,
+				// Droplets powered off are billed until destroyed.
+				Stopped: droplet.Status == "off",
+				Tags:    tags,
+			})
+		}
+
+		if result.Links.Pages.Next == "" {
+			return instances, nil
+		}
+	}
+}
+
+// digitalOceanTags converts tags to "key:value" DigitalOcean tags.
+func digitalOceanTags(tags map[string]string) []string {
+	doTags := []string{}
+	for key, value := range sanitizeLabels(tags) {
+		doTags = append(doTags, key+":"+value)
+	}
+	return doTags
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/cterence/tailout/tailout/config"
+)
+
+// newDigitalOceanTestServer returns a DigitalOcean client talking to handler,
+// and the requests it received as "METHOD path".
+func newDigitalOceanTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body map[string]any)) (*DigitalOcean, *[]string) {
+	t.Helper()
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("missing token on %s %s", r.Method, r.URL)
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		body := map[string]any{}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("invalid request body: %v", err)
+			}
+		}
+		handler(w, r, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewDigitalOcean(config.DigitalOceanConfig{Token: "test-token", Endpoint: server.URL}), &requests
+}
+
+func TestDigitalOceanList(t *testing.T) {
+	cloud, _ := newDigitalOceanTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		if got := r.URL.Query().Get("tag_name"); got != "tailout" {
+			t.Errorf("unexpected tag filter %q", got)
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			io.WriteString(w, `{"droplets": [{"id": 1, "status": "active", "tags": ["tailout", "app:tailout", "tailout_expires-at:1700000000"], "size_slug": "s-1vcpu-512mb-10gb", "region": {"slug": "ams3"}, "networks": {"v4": [{"ip_address": "10.0.0.2", "type": "private"}, {"ip_address": "203.0.113.1", "type": "public"}]}}], "links": {"pages": {"next": "page=2"}}}`)
+		default:
+			io.WriteString(w, `{"droplets": [{"id": 2, "status": "off", "tags": ["tailout", "app:tailout"], "size_slug": "s-1vcpu-1gb", "region": {"slug": "fra1"}}], "links": {"pages": {}}}`)
+		}
+	})
+
+	instances, err := cloud.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 2 {
+		t.Fatalf("got %d instances, want 2", len(instances))
+	}
+	if got := instances[0]; got.ID != "1" || got.Region != "ams3" || got.PublicIP != "203.0.113.1" || got.Stopped || got.Tag(TagApp) != "tailout" || got.Tag(TagExpiresAt) != "1700000000" {
+		t.Errorf("unexpected running droplet %+v", got)
+	}
+	if got := instances[1]; got.ID != "2" || got.Region != "fra1" || got.InstanceType != "s-1vcpu-1gb" || !got.Stopped {
+		t.Errorf("unexpected powered off droplet %+v", got)
+	}
+}
+
+func TestDigitalOceanTag(t *testing.T) {
+	cloud, requests := newDigitalOceanTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /droplets/7":
+			io.WriteString(w, `{"droplet": {"id": 7, "tags": ["tailout", "app:tailout", "tailout_expires-at:1700000000"]}}`)
+		case "DELETE /tags/tailout_expires-at:1700000000/resources", "POST /tags", "POST /tags/tailout_expires-at:never/resources":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	if err := cloud.Tag(context.Background(), "ams3", "7", map[string]string{TagExpiresAt: ExpiresNever}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous value of the tag is removed before the new one is added.
+	want := []string{"GET /droplets/7", "DELETE /tags/tailout_expires-at:1700000000/resources", "POST /tags", "POST /tags/tailout_expires-at:never/resources"}
+	if !slices.Equal(*requests, want) {
+		t.Errorf("requests %v, want %v", *requests, want)
+	}
+}
+
+func TestDigitalOceanTerminate(t *testing.T) {
+	cloud, requests := newDigitalOceanTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := cloud.Terminate(context.Background(), "ams3", "7", true); err != ErrDryRun {
+		t.Errorf("dry run returned %v, want %v", err, ErrDryRun)
+	}
+	if err := cloud.Terminate(context.Background(), "ams3", "7", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"DELETE /droplets/7"}; !slices.Equal(*requests, want) {
+		t.Errorf("requests %v, want %v", *requests, want)
+	}
+}
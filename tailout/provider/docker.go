@@ -0,0 +1,279 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/tailout/config"
+)
+
+const (
+	dockerRegion       = "local"
+	dockerDefaultImage = "docker.io/tailscale/tailscale:stable"
+	// dockerExpiryFile holds the expiry of a container, in the format of
+	// TagExpiresAt, since its labels cannot be changed.
+	dockerExpiryFile = "/tmp/tailout-expires-at"
+)
+
+// dockerEntrypoint runs tailscale until the expiry written in
+// dockerExpiryFile, which starts as the first argument.
+const dockerEntrypoint = `echo "$1" > ` + dockerExpiryFile + `
+/usr/local/bin/containerboot &
+boot=$!
+trap 'kill "$boot"; exit 0' TERM INT
+while sleep 10; do
+  kill -0 "$boot" 2>/dev/null || exit 1
+  expires_at=$(cat ` + dockerExpiryFile + `)
+  if [ "$expires_at" != ` + ExpiresNever + ` ] && [ "$(date +%s)" -ge "$expires_at" ]; then
+    exit 0
+  fi
+done`
+
+// Docker runs exit nodes as local tailscale containers, with Docker or
+// Podman. It only has the "local" region, and ignores the bootstrap script:
+// the container runs tailscaled directly.
+type Docker struct {
+	binary string
+	image  string
+}
+
+func NewDocker(c config.DockerConfig) *Docker {
+	image := c.Image
+	if image == "" {
+		image = dockerDefaultImage
+	}
+
+	return &Docker{
+		binary: c.Binary,
+		image:  image,
+	}
+}
+
+func (p *Docker) Name() string {
+	return "docker"
+}
+
+// run executes the container engine CLI, preferring Docker over Podman when
+// no binary is configured.
+func (p *Docker) run(ctx context.Context, args ...string) (string, error) {
+	if p.binary == "" {
+		for _, binary := range []string{"docker", "podman"} {
+			if _, err := exec.LookPath(binary); err == nil {
+				p.binary = binary
+				break
+			}
+		}
+		if p.binary == "" {
+			return "", errors.New("neither docker nor podman found in PATH")
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", p.binary, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (p *Docker) Account(ctx context.Context) (string, error) {
+	host, err := p.run(ctx, "info", "--format", "{{.Name}}")
+	if err != nil {
+		return "", fmt.Errorf("failed to reach container engine: %w", err)
+	}
+	return fmt.Sprintf("%s on %s", p.binary, host), nil
+}
+
+func (p *Docker) Regions(ctx context.Context) ([]string, error) {
+	return []string{dockerRegion}, nil
+}
+
+func (p *Docker) DefaultInstanceType() string {
+	return "container"
+}
+
+func (p *Docker) FindImage(ctx context.Context, region, instanceType string) (Image, error) {
+	return Image{
+		ID:   p.image,
+		Name: p.image,
+	}, nil
+}
+
+func (p *Docker) SetupScript() string {
+	return ""
+}
+
+// Launch starts a container running tailscaled, which is removed once its
+// expiry is reached.
+func (p *Docker) Launch(ctx context.Context, input LaunchInput) (Instance, error) {
+	if input.DryRun {
+		return Instance{}, ErrDryRun
+	}
+
+	if input.IdleTimeout != 0 {
+		return Instance{}, errors.New("idle timeout is not supported by containers")
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Instance{}, fmt.Errorf("failed to generate container name: %w", err)
+	}
+	id := hex.EncodeToString(suffix)
+	name := NodeName(input.Region, id)
+
+	args := []string{
+		"run", "--detach", "--rm",
+		"--name", name,
+		"--hostname", name,
+		"--cap-add", "NET_ADMIN",
+		"--cap-add", "NET_RAW",
+		"--device", "/dev/net/tun",
+		"--sysctl", "net.ipv4.ip_forward=1",
+		"--sysctl", "net.ipv6.conf.all.forwarding=1",
+		"--env", "TS_AUTHKEY=" + input.AuthKey,
+		"--env", "TS_HOSTNAME=" + name,
+		"--env", "TS_USERSPACE=false",
+		"--env", "TS_EXTRA_ARGS=" + strings.Join(input.TailscaleArgs, " "),
+		"--label", "Name=" + name,
+	}
+	for key, value := range input.Tags {
+		args = append(args, "--label", key+"="+value)
+	}
+	expiresAt := ExpiresNever
+	if input.Shutdown > 0 {
+		expiresAt = strconv.FormatInt(time.Now().Add(input.Shutdown).Unix(), 10)
+	}
+	args = append(args,
+		"--entrypoint", "/bin/sh",
+		input.Image.ID,
+		"-c", dockerEntrypoint, "tailout", expiresAt,
+	)
+
+	if _, err := p.run(ctx, args...); err != nil {
+		return Instance{}, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	return Instance{
+		ID:     id,
+		Region: input.Region,
+	}, nil
+}
+
+// Tag only succeeds when the container already holds the tags, since labels
+// cannot be changed once a container is created. The expiry is written to the
+// expiry file of the container instead, and the tailscale IP is not recorded,
+// containers are matched to their node by name.
+func (p *Docker) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	for key, value := range tags {
+		switch key {
+		case TagTailscaleIP:
+			continue
+		case TagExpiresAt:
+			if _, err := p.run(ctx, "exec", NodeName(region, id), "sh", "-c", `echo "$1" > `+dockerExpiryFile, "tailout", value); err != nil {
+				return fmt.Errorf("failed to update the expiry of the container: %w", err)
+			}
+			continue
+		}
+		current, err := p.run(ctx, "inspect", "--format", fmt.Sprintf("{{index .Config.Labels %q}}", key), NodeName(region, id))
+		if err != nil {
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+		if current != value {
+			return fmt.Errorf("cannot set label %s on a running container", key)
+		}
+	}
+	return nil
+}
+
+// EnforcesExpiry reports that containers remove themselves at the expiry
+// set with Tag.
+func (p *Docker) EnforcesExpiry() bool {
+	return true
+}
+
+func (p *Docker) WaitRunning(ctx context.Context, region, id string) error {
+	return poll(ctx, 2*time.Minute, time.Second, func() (bool, error) {
+		running, err := p.run(ctx, "inspect", "--format", "{{.State.Running}}", NodeName(region, id))
+		if err != nil {
+			return false, fmt.Errorf("failed to inspect container: %w", err)
+		}
+		return running == "true", nil
+	})
+}
+
+// PublicIP returns the IP address of the container on its network, as the
+// container has no public IP address of its own.
+func (p *Docker) PublicIP(ctx context.Context, region, id string) (string, error) {
+	ip, err := p.run(ctx, "inspect", "--format", "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}", NodeName(region, id))
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	fields := strings.Fields(ip)
+	if len(fields) == 0 {
+		return "", errors.New("no IP address found")
+	}
+
+	return fields[0], nil
+}
+
+func (p *Docker) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	if dryRun {
+		return ErrDryRun
+	}
+
+	if _, err := p.run(ctx, "rm", "--force", NodeName(region, id)); err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+	return nil
+}
+
+func (p *Docker) List(ctx context.Context) ([]Instance, error) {
+	names, err := p.run(ctx, "ps", "--filter", "label="+TagApp+"=tailout", "--format", "{{.Names}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	instances := []Instance{}
+	for _, name := range strings.Fields(names) {
+		output, err := p.run(ctx, "inspect", "--format", `{"labels":{{json .Config.Labels}},"created":{{json .Created}}}`, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect container: %w", err)
+		}
+
+		var container struct {
+			Labels  map[string]string `json:"labels"`
+			Created time.Time         `json:"created"`
+		}
+		if err := json.Unmarshal([]byte(output), &container); err != nil {
+			return nil, fmt.Errorf("failed to parse container %s: %w", name, err)
+		}
+
+		// The label holds the expiry the container was created with.
+		if expiresAt, err := p.run(ctx, "exec", name, "cat", dockerExpiryFile); err == nil {
+			container.Labels[TagExpiresAt] = expiresAt
+		}
+
+		instances = append(instances, Instance{
+			ID:           strings.TrimPrefix(name, NodeName(dockerRegion, "")),
+			Region:       dockerRegion,
+			InstanceType: p.DefaultInstanceType(),
+			CreatedAt:    container.Created,
+			Tags:         container.Labels,
+		})
+	}
+	return instances, nil
+}
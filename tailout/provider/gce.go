@@ -0,0 +1,401 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/cterence/tailout/internal/rest"
+	"github.com/cterence/tailout/tailout/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const gceBaseURL = "https://compute.googleapis.com/compute/v1"
+
+// GCE launches exit nodes as Spot VMs on Google Compute Engine. Regions are
+// Compute Engine zones, since that is where VMs live.
+type GCE struct {
+	project string
+	api     *rest.Client
+}
+
+func NewGCE(c config.GCEConfig) *GCE {
+	return &GCE{
+		project: c.Project,
+	}
+}
+
+func (p *GCE) Name() string {
+	return "gce"
+}
+
+// client lazily resolves the application default credentials, and the
+// project from them when none is configured.
+func (p *GCE) client(ctx context.Context) (*rest.Client, error) {
+	if p.api != nil {
+		return p.api, nil
+	}
+
+	creds, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/compute")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Google Cloud credentials: %w", err)
+	}
+
+	if p.project == "" {
+		p.project = creds.ProjectID
+	}
+	if p.project == "" {
+		return nil, errors.New("no Google Cloud project found, set gce.project in the configuration")
+	}
+
+	p.api = &rest.Client{
+		HTTPClient: oauth2.NewClient(ctx, creds.TokenSource),
+		BaseURL:    gceBaseURL + "/projects/" + p.project,
+	}
+	return p.api, nil
+}
+
+func (p *GCE) Account(ctx context.Context) (string, error) {
+	if _, err := p.client(ctx); err != nil {
+		return "", err
+	}
+	return "Google Cloud project " + p.project, nil
+}
+
+func (p *GCE) Regions(ctx context.Context) ([]string, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var zones struct {
+		Items []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"items"`
+	}
+	if err := api.Do(ctx, http.MethodGet, "/zones?maxResults=500", nil, &zones); err != nil {
+		return nil, fmt.Errorf("failed to list zones: %w", err)
+	}
+
+	zoneNames := []string{}
+	for _, zone := range zones.Items {
+		if zone.Status == "UP" {
+			zoneNames = append(zoneNames, zone.Name)
+		}
+	}
+
+	return zoneNames, nil
+}
+
+func (p *GCE) DefaultInstanceType() string {
+	return "e2-micro"
+}
+
+func (p *GCE) FindImage(ctx context.Context, region, instanceType string) (Image, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return Image{}, err
+	}
+
+	var image struct {
+		Name     string `json:"name"`
+		SelfLink string `json:"selfLink"`
+	}
+	err = api.Do(ctx, http.MethodGet, gceBaseURL+"/projects/debian-cloud/global/images/family/debian-12", nil, &image)
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to get Debian image: %w", err)
+	}
+
+	return Image{
+		ID:   image.SelfLink,
+		Name: image.Name,
+	}, nil
+}
+
+func (p *GCE) SetupScript() string {
+	return `apt-get update && apt-get install -y at
+INSTANCE_ID=$(curl -sSL -H "Metadata-Flavor: Google" http://metadata.google.internal/computeMetadata/v1/instance/id)`
+}
+
+// InterruptionCheck succeeds once the VM has been preempted, 30 seconds
+// before it is stopped.
+func (p *GCE) InterruptionCheck() string {
+	return `[ "$(curl -sf -H "Metadata-Flavor: Google" http://metadata.google.internal/computeMetadata/v1/instance/preempted)" = "TRUE" ]`
+}
+
+func (p *GCE) Launch(ctx context.Context, input LaunchInput) (Instance, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	if input.DryRun {
+		return Instance{}, ErrDryRun
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Instance{}, fmt.Errorf("failed to generate instance name: %w", err)
+	}
+
+	body := map[string]any{
+		"name":         "tailout-" + hex.EncodeToString(suffix),
+		"machineType":  "zones/" + input.Region + "/machineTypes/" + input.InstanceType,
+		"canIpForward": true,
+		"labels":       sanitizeLabels(input.Tags),
+		"scheduling": map[string]any{
+			"provisioningModel":         "SPOT",
+			"instanceTerminationAction": "DELETE",
+			"automaticRestart":          false,
+			"onHostMaintenance":         "TERMINATE",
+		},
+		"disks": []map[string]any{
+			{
+				"boot":       true,
+				"autoDelete": true,
+				"initializeParams": map[string]any{
+					"sourceImage": input.Image.ID,
+				},
+			},
+		},
+		"networkInterfaces": []map[string]any{
+			{
+				"network": "global/networks/default",
+				"accessConfigs": []map[string]any{
+					{"type": "ONE_TO_ONE_NAT", "name": "External NAT"},
+				},
+			},
+		},
+		"metadata": map[string]any{
+			"items": []map[string]any{
+				{"key": "startup-script", "value": input.UserData},
+			},
+		},
+	}
+
+	var operation gceOperation
+	if err := api.Do(ctx, http.MethodPost, "/zones/"+input.Region+"/instances", body, &operation); err != nil {
+		return Instance{}, fmt.Errorf("failed to create Compute Engine instance: %w", err)
+	}
+
+	if operation.TargetID == "" {
+		return Instance{}, errors.New("no instances created")
+	}
+
+	// The instance cannot be tagged before the insert is done.
+	if err := p.waitOperation(ctx, input.Region, operation); err != nil {
+		return Instance{}, fmt.Errorf("failed to create Compute Engine instance: %w", err)
+	}
+
+	return Instance{
+		ID:     operation.TargetID,
+		Region: input.Region,
+	}, nil
+}
+
+// gceOperationInterval is how often zone operations are polled.
+var gceOperationInterval = 2 * time.Second
+
+type gceOperation struct {
+	Name     string `json:"name"`
+	TargetID string `json:"targetId"`
+	Status   string `json:"status"`
+	Error    *struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// waitOperation polls a zone operation until it is done, and returns its
+// error if it failed.
+func (p *GCE) waitOperation(ctx context.Context, zone string, operation gceOperation) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	for operation.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(gceOperationInterval):
+		}
+
+		if err := api.Do(ctx, http.MethodGet, "/zones/"+zone+"/operations/"+url.PathEscape(operation.Name), nil, &operation); err != nil {
+			return fmt.Errorf("failed to get operation %s: %w", operation.Name, err)
+		}
+	}
+
+	if operation.Error != nil && len(operation.Error.Errors) > 0 {
+		e := operation.Error.Errors[0]
+		return fmt.Errorf("operation %s failed: %s: %s", operation.Name, e.Code, e.Message)
+	}
+	return nil
+}
+
+type gceInstance struct {
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	MachineType       string            `json:"machineType"`
+	CreationTimestamp time.Time         `json:"creationTimestamp"`
+	Labels            map[string]string `json:"labels"`
+	LabelFingerprint  string            `json:"labelFingerprint"`
+	NetworkInterfaces []struct {
+		AccessConfigs []struct {
+			NatIP string `json:"natIP"`
+		} `json:"accessConfigs"`
+	} `json:"networkInterfaces"`
+}
+
+// Compute Engine accepts instance IDs wherever an instance name is expected.
+func (p *GCE) get(ctx context.Context, zone, id string) (gceInstance, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return gceInstance{}, err
+	}
+
+	var instance gceInstance
+	if err := api.Do(ctx, http.MethodGet, "/zones/"+zone+"/instances/"+url.PathEscape(id), nil, &instance); err != nil {
+		return gceInstance{}, fmt.Errorf("failed to describe Compute Engine instance: %w", err)
+	}
+	return instance, nil
+}
+
+func (p *GCE) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	instance, err := p.get(ctx, region, id)
+	if err != nil {
+		return err
+	}
+
+	labels := instance.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range sanitizeLabels(tags) {
+		labels[key] = value
+	}
+
+	err = api.Do(ctx, http.MethodPost, "/zones/"+region+"/instances/"+url.PathEscape(id)+"/setLabels", map[string]any{
+		"labels":           labels,
+		"labelFingerprint": instance.LabelFingerprint,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add labels to the instance: %w", err)
+	}
+	return nil
+}
+
+func (p *GCE) WaitRunning(ctx context.Context, region, id string) error {
+	return poll(ctx, 2*time.Minute, 5*time.Second, func() (bool, error) {
+		instance, err := p.get(ctx, region, id)
+		if err != nil {
+			return false, err
+		}
+		return instance.Status == "RUNNING", nil
+	})
+}
+
+func (p *GCE) PublicIP(ctx context.Context, region, id string) (string, error) {
+	instance, err := p.get(ctx, region, id)
+	if err != nil {
+		return "", err
+	}
+
+	if publicIP := instance.publicIP(); publicIP != "" {
+		return publicIP, nil
+	}
+	return "", errors.New("no public IP address found")
+}
+
+func (i gceInstance) publicIP() string {
+	for _, networkInterface := range i.NetworkInterfaces {
+		for _, accessConfig := range networkInterface.AccessConfigs {
+			if accessConfig.NatIP != "" {
+				return accessConfig.NatIP
+			}
+		}
+	}
+	return ""
+}
+
+func (p *GCE) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	api, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return ErrDryRun
+	}
+
+	if err := api.Do(ctx, http.MethodDelete, "/zones/"+region+"/instances/"+url.PathEscape(id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete Compute Engine instance: %w", err)
+	}
+	return nil
+}
+
+func (p *GCE) List(ctx context.Context) ([]Instance, error) {
+	api, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []Instance{}
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("filter", "labels."+sanitizeLabel(TagApp)+" = tailout")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		var result struct {
+			Items map[string]struct {
+				Instances []gceInstance `json:"instances"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := api.Do(ctx, http.MethodGet, "/aggregated/instances?"+query.Encode(), nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to list Compute Engine instances: %w", err)
+		}
+
+		// Items are keyed by "zones/<zone>".
+		for scope, items := range result.Items {
+			zone := path.Base(scope)
+			for _, instance := range items.Instances {
+				// Instances shut down from the inside are TERMINATED but
+				// not deleted, their disk is still billed.
+				instances = append(instances, Instance{
+					ID:           instance.ID,
+					Region:       zone,
+					PublicIP:     instance.publicIP(),
+					InstanceType: path.Base(instance.MachineType),
+					Market:       MarketSpot,
+					CreatedAt:    instance.CreationTimestamp,
+					Stopped:      instance.Status == "STOPPING" || instance.Status == "SUSPENDED" || instance.Status == "TERMINATED",
+					Tags:         instance.Labels,
+				})
+			}
+		}
+
+		if result.NextPageToken == "" {
+			return instances, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cterence/tailout/internal/rest"
+)
+
+func TestGCEWaitOperation(t *testing.T) {
+	gceOperationInterval = 0
+	tests := []struct {
+		name      string
+		responses []string
+		wantErr   string
+	}{
+		{"done", []string{`{"name": "op-1", "status": "RUNNING"}`, `{"name": "op-1", "status": "DONE"}`}, ""},
+		{"failed", []string{`{"name": "op-1", "status": "DONE", "error": {"errors": [{"code": "ZONE_RESOURCE_POOL_EXHAUSTED", "message": "no capacity"}]}}`}, "ZONE_RESOURCE_POOL_EXHAUSTED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/zones/europe-west1-b/operations/op-1" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				io.WriteString(w, tt.responses[min(polls, len(tt.responses)-1)])
+				polls++
+			}))
+			defer server.Close()
+
+			cloud := &GCE{project: "test", api: &rest.Client{HTTPClient: server.Client(), BaseURL: server.URL}}
+			err := cloud.waitOperation(context.Background(), "europe-west1-b", gceOperation{Name: "op-1", Status: "PENDING"})
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if polls != len(tt.responses) {
+				t.Errorf("polled %d times, want %d", polls, len(tt.responses))
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/internal/rest"
+	"github.com/cterence/tailout/tailout/config"
+)
+
+const hetznerBaseURL = "https://api.hetzner.cloud/v1"
+
+// hetznerLocations are the Hetzner Cloud locations exit nodes can run in.
+var hetznerLocations = []string{"fsn1", "nbg1", "hel1", "ash", "hil", "sin"}
+
+// Hetzner launches exit nodes as Hetzner Cloud servers. Regions are Hetzner
+// Cloud locations.
+type Hetzner struct {
+	api *rest.Client
+}
+
+func NewHetzner(c config.HetznerConfig) *Hetzner {
+	token := c.Token
+	if token == "" {
+		token = os.Getenv("HCLOUD_TOKEN")
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = hetznerBaseURL
+	}
+
+	return &Hetzner{
+		api: &rest.Client{
+			BaseURL: endpoint,
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + token},
+			},
+		},
+	}
+}
+
+func (p *Hetzner) Name() string {
+	return "hetzner"
+}
+
+func (p *Hetzner) Account(ctx context.Context) (string, error) {
+	// API tokens are scoped to a single project, which the API does not name.
+	var servers struct{}
+	if err := p.api.Do(ctx, http.MethodGet, "/servers?per_page=1", nil, &servers); err != nil {
+		return "", fmt.Errorf("failed to check Hetzner Cloud token: %w", err)
+	}
+	return "Hetzner Cloud project of the configured token", nil
+}
+
+func (p *Hetzner) Regions(ctx context.Context) ([]string, error) {
+	return append([]string{}, hetznerLocations...), nil
+}
+
+// RegionEndpoint returns the speed test server of the location.
+func (p *Hetzner) RegionEndpoint(region string) string {
+	return region + "-speed.hetzner.com:443"
+}
+
+func (p *Hetzner) DefaultInstanceType() string {
+	return "cpx11"
+}
+
+// BillingIncrement returns the billing granularity of Hetzner Cloud servers,
+// which are billed for every started hour.
+func (p *Hetzner) BillingIncrement() time.Duration {
+	return time.Hour
+}
+
+func (p *Hetzner) FindImage(ctx context.Context, region, instanceType string) (Image, error) {
+	var images struct {
+		Images []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"images"`
+	}
+	// Ampere server types are the only arm64 ones.
+	architecture := "x86"
+	if strings.HasPrefix(instanceType, "cax") {
+		architecture = "arm"
+	}
+
+	if err := p.api.Do(ctx, http.MethodGet, "/images?type=system&name=debian-12&architecture="+architecture, nil, &images); err != nil {
+		return Image{}, fmt.Errorf("failed to get Debian image: %w", err)
+	}
+
+	if len(images.Images) == 0 {
+		return Image{}, errors.New("no Debian images found")
+	}
+
+	return Image{
+		ID:   strconv.FormatInt(images.Images[0].ID, 10),
+		Name: images.Images[0].Name,
+	}, nil
+}
+
+func (p *Hetzner) SetupScript() string {
+	return `apt-get update && apt-get install -y at
+INSTANCE_ID=$(curl -sSL http://169.254.169.254/hetzner/v1/metadata/instance-id)`
+}
+
+func (p *Hetzner) Launch(ctx context.Context, input LaunchInput) (Instance, error) {
+	if input.DryRun {
+		return Instance{}, ErrDryRun
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Instance{}, fmt.Errorf("failed to generate server name: %w", err)
+	}
+
+	imageID, err := strconv.ParseInt(input.Image.ID, 10, 64)
+	if err != nil {
+		return Instance{}, fmt.Errorf("invalid image ID %q: %w", input.Image.ID, err)
+	}
+
+	var result struct {
+		Server hetznerServer `json:"server"`
+	}
+	err = p.api.Do(ctx, http.MethodPost, "/servers", map[string]any{
+		"name":               "tailout-" + hex.EncodeToString(suffix),
+		"server_type":        input.InstanceType,
+		"image":              imageID,
+		"location":           input.Region,
+		"user_data":          input.UserData,
+		"labels":             sanitizeLabels(input.Tags),
+		"start_after_create": true,
+		"public_net": map[string]any{
+			"enable_ipv4": true,
+			"enable_ipv6": true,
+		},
+	}, &result)
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to create Hetzner Cloud server: %w", err)
+	}
+
+	return Instance{
+		ID:     strconv.FormatInt(result.Server.ID, 10),
+		Region: input.Region,
+	}, nil
+}
+
+type hetznerServer struct {
+	ID         int64             `json:"id"`
+	Status     string            `json:"status"`
+	Labels     map[string]string `json:"labels"`
+	Created    time.Time         `json:"created"`
+	ServerType struct {
+		Name string `json:"name"`
+	} `json:"server_type"`
+	Datacenter struct {
+		Location struct {
+			Name string `json:"name"`
+		} `json:"location"`
+	} `json:"datacenter"`
+	PublicNet struct {
+		IPv4 *struct {
+			ID int64  `json:"id"`
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+		IPv6 *struct {
+			ID int64 `json:"id"`
+		} `json:"ipv6"`
+	} `json:"public_net"`
+}
+
+func (p *Hetzner) get(ctx context.Context, id string) (hetznerServer, error) {
+	var result struct {
+		Server hetznerServer `json:"server"`
+	}
+	if err := p.api.Do(ctx, http.MethodGet, "/servers/"+id, nil, &result); err != nil {
+		return hetznerServer{}, fmt.Errorf("failed to describe Hetzner Cloud server: %w", err)
+	}
+	return result.Server, nil
+}
+
+func (p *Hetzner) Tag(ctx context.Context, region, id string, tags map[string]string) error {
+	server, err := p.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	labels := server.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range sanitizeLabels(tags) {
+		labels[key] = value
+	}
+
+	err = p.api.Do(ctx, http.MethodPut, "/servers/"+id, map[string]any{
+		"labels": labels,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add labels to the server: %w", err)
+	}
+	return nil
+}
+
+func (p *Hetzner) WaitRunning(ctx context.Context, region, id string) error {
+	return poll(ctx, 2*time.Minute, 5*time.Second, func() (bool, error) {
+		server, err := p.get(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		return server.Status == "running", nil
+	})
+}
+
+func (p *Hetzner) PublicIP(ctx context.Context, region, id string) (string, error) {
+	server, err := p.get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if server.PublicNet.IPv4 == nil || server.PublicNet.IPv4.IP == "" {
+		return "", errors.New("no public IP address found")
+	}
+
+	return server.PublicNet.IPv4.IP, nil
+}
+
+// Terminate deletes the server, then the primary IPs that were assigned to
+// it so they are not billed once the server is gone.
+func (p *Hetzner) Terminate(ctx context.Context, region, id string, dryRun bool) error {
+	server, err := p.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return ErrDryRun
+	}
+
+	var result struct {
+		Action hetznerAction `json:"action"`
+	}
+	if err := p.api.Do(ctx, http.MethodDelete, "/servers/"+id, nil, &result); err != nil {
+		return fmt.Errorf("failed to delete Hetzner Cloud server: %w", err)
+	}
+
+	if err := p.waitAction(ctx, result.Action.ID); err != nil {
+		return fmt.Errorf("failed to wait for server deletion: %w", err)
+	}
+
+	primaryIPs := []int64{}
+	if server.PublicNet.IPv4 != nil {
+		primaryIPs = append(primaryIPs, server.PublicNet.IPv4.ID)
+	}
+	if server.PublicNet.IPv6 != nil {
+		primaryIPs = append(primaryIPs, server.PublicNet.IPv6.ID)
+	}
+
+	for _, primaryIP := range primaryIPs {
+		// Primary IPs flagged with auto_delete are already gone.
+		err := p.api.Do(ctx, http.MethodDelete, "/primary_ips/"+strconv.FormatInt(primaryIP, 10), nil, nil)
+		if err != nil && !rest.IsNotFound(err) {
+			return fmt.Errorf("failed to delete primary IP: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Hetzner) List(ctx context.Context) ([]Instance, error) {
+	instances := []Instance{}
+	for page := 1; page != 0; {
+		query := url.Values{}
+		query.Set("label_selector", sanitizeLabel(TagApp)+"==tailout")
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", "50")
+
+		var result struct {
+			Servers []hetznerServer `json:"servers"`
+			Meta    struct {
+				Pagination struct {
+					NextPage int `json:"next_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := p.api.Do(ctx, http.MethodGet, "/servers?"+query.Encode(), nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to list Hetzner Cloud servers: %w", err)
+		}
+
+		for _, server := range result.Servers {
+			instance := Instance{
+				ID:           strconv.FormatInt(server.ID, 10),
+				Region:       server.Datacenter.Location.Name,
+				InstanceType: server.ServerType.Name,
+				Market:       MarketOnDemand,
+				CreatedAt:    server.Created,
+				// Servers powered off are billed until deleted.
+				Stopped: server.Status == "off" || server.Status == "stopping",
+				Tags:    server.Labels,
+			}
+			if server.PublicNet.IPv4 != nil {
+				instance.PublicIP = server.PublicNet.IPv4.IP
+			}
+			instances = append(instances, instance)
+		}
+
+		page = result.Meta.Pagination.NextPage
+	}
+	return instances, nil
+}
+
+type hetznerAction struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *Hetzner) waitAction(ctx context.Context, id int64) error {
+	return poll(ctx, 2*time.Minute, 2*time.Second, func() (bool, error) {
+		var result struct {
+			Action hetznerAction `json:"action"`
+		}
+		if err := p.api.Do(ctx, http.MethodGet, "/actions/"+strconv.FormatInt(id, 10), nil, &result); err != nil {
+			return false, err
+		}
+
+		switch result.Action.Status {
+		case "success":
+			return true, nil
+		case "error":
+			if result.Action.Error != nil {
+				return false, errors.New(result.Action.Error.Message)
+			}
+			return false, errors.New("action failed")
+		default:
+			return false, nil
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/cterence/tailout/tailout/config"
+)
+
+// newHetznerTestServer returns a Hetzner Cloud client talking to handler,
+// and the requests it received as "METHOD path".
+func newHetznerTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body map[string]any)) (*Hetzner, *[]string) {
+	t.Helper()
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("missing token on %s %s", r.Method, r.URL)
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		body := map[string]any{}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("invalid request body: %v", err)
+			}
+		}
+		handler(w, r, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewHetzner(config.HetznerConfig{Token: "test-token", Endpoint: server.URL}), &requests
+}
+
+func TestHetznerList(t *testing.T) {
+	cloud, _ := newHetznerTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		if got := r.URL.Query().Get("label_selector"); got != "app==tailout" {
+			t.Errorf("unexpected label selector %q", got)
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			io.WriteString(w, `{"servers": [{"id": 1, "status": "running", "labels": {"app": "tailout"}, "server_type": {"name": "cpx11"}, "datacenter": {"location": {"name": "fsn1"}}, "public_net": {"ipv4": {"id": 10, "ip": "203.0.113.1"}}}], "meta": {"pagination": {"next_page": 2}}}`)
+		default:
+			io.WriteString(w, `{"servers": [{"id": 2, "status": "off", "labels": {"app": "tailout"}, "server_type": {"name": "cax11"}, "datacenter": {"location": {"name": "hel1"}}, "public_net": {}}], "meta": {"pagination": {"next_page": null}}}`)
+		}
+	})
+
+	instances, err := cloud.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Instance{
+		{ID: "1", Region: "fsn1", PublicIP: "203.0.113.1", InstanceType: "cpx11", Market: MarketOnDemand, Tags: map[string]string{"app": "tailout"}},
+		{ID: "2", Region: "hel1", InstanceType: "cax11", Market: MarketOnDemand, Stopped: true, Tags: map[string]string{"app": "tailout"}},
+	}
+	if len(instances) != len(want) {
+		t.Fatalf("got %d instances, want %d", len(instances), len(want))
+	}
+	for i := range want {
+		got := instances[i]
+		if got.ID != want[i].ID || got.Region != want[i].Region || got.PublicIP != want[i].PublicIP ||
+			got.InstanceType != want[i].InstanceType || got.Market != want[i].Market || got.Stopped != want[i].Stopped ||
+			got.Tag(TagApp) != "tailout" {
+			t.Errorf("instance %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestHetznerLaunchAndTag(t *testing.T) {
+	labels := map[string]any{}
+	cloud, _ := newHetznerTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /servers":
+			if body["server_type"] != "cpx11" || body["location"] != "nbg1" || body["image"] != float64(42) || body["user_data"] != "#!/bin/bash" {
+				t.Errorf("unexpected server request %v", body)
+			}
+			labels = body["labels"].(map[string]any)
+			io.WriteString(w, `{"server": {"id": 7}}`)
+		case "GET /servers/7":
+			json.NewEncoder(w).Encode(map[string]any{"server": map[string]any{"id": 7, "labels": labels}})
+		case "PUT /servers/7":
+			labels = body["labels"].(map[string]any)
+			io.WriteString(w, `{}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	instance, err := cloud.Launch(context.Background(), LaunchInput{
+		Region:       "nbg1",
+		Image:        Image{ID: "42"},
+		InstanceType: "cpx11",
+		UserData:     "#!/bin/bash",
+		Tags:         map[string]string{TagApp: "tailout", TagExpiresAt: "1700000000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.ID != "7" || instance.Region != "nbg1" {
+		t.Errorf("unexpected instance %+v", instance)
+	}
+
+	if err := cloud.Tag(context.Background(), "nbg1", "7", map[string]string{TagName: "tailout-nbg1-7"}); err != nil {
+		t.Fatal(err)
+	}
+	// Labels are sanitized and merged with the existing ones.
+	want := map[string]any{"app": "tailout", "tailout_expires-at": "1700000000", "name": "tailout-nbg1-7"}
+	for key, value := range want {
+		if labels[key] != value {
+			t.Errorf("label %s = %v, want %v (labels %v)", key, labels[key], value, labels)
+		}
+	}
+}
+
+func TestHetznerTerminate(t *testing.T) {
+	cloud, requests := newHetznerTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /servers/7":
+			io.WriteString(w, `{"server": {"id": 7, "public_net": {"ipv4": {"id": 10, "ip": "203.0.113.1"}, "ipv6": {"id": 11}}}}`)
+		case "DELETE /servers/7":
+			io.WriteString(w, `{"action": {"id": 3, "status": "running"}}`)
+		case "GET /actions/3":
+			io.WriteString(w, `{"action": {"id": 3, "status": "success"}}`)
+		case "DELETE /primary_ips/10":
+			w.WriteHeader(http.StatusNoContent)
+		case "DELETE /primary_ips/11":
+			// Already deleted along with the server.
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	if err := cloud.Terminate(context.Background(), "nbg1", "7", false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"GET /servers/7", "DELETE /servers/7", "GET /actions/3", "DELETE /primary_ips/10", "DELETE /primary_ips/11"}
+	if !slices.Equal(*requests, want) {
+		t.Errorf("requests %v, want %v", *requests, want)
+	}
+}
@@ -0,0 +1,235 @@
+package provider
+
+import (
+	"strings"
+)
+
+// Location is the physical location of a region.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country.
+	Country string `json:"country" yaml:"country"`
+	City    string `json:"city" yaml:"city"`
+}
+
+// CountryName returns the English name of the country of the location.
+func (l Location) CountryName() string {
+	if name, ok := countryNames[l.Country]; ok {
+		return name
+	}
+	return l.Country
+}
+
+func (l Location) String() string {
+	return l.City + ", " + l.CountryName()
+}
+
+// Matches reports whether the location is in the given country, by code or
+// name, and city, ignoring case. Empty arguments match any location.
+func (l Location) Matches(country, city string) bool {
+	if country != "" && !strings.EqualFold(country, l.Country) && !strings.EqualFold(country, l.CountryName()) {
+		return false
+	}
+	if city != "" && !strings.EqualFold(city, l.City) {
+		return false
+	}
+	return true
+}
+
+// RegionLocation returns the location of a region of the named provider.
+// Zones, such as Google Cloud ones, are located with their region.
+func RegionLocation(providerName, region string) (Location, bool) {
+	locations := regionLocations[providerName]
+	if location, ok := locations[region]; ok {
+		return location, true
+	}
+	if i := strings.LastIndex(region, "-"); i > 0 {
+		location, ok := locations[region[:i]]
+		return location, ok
+	}
+	return Location{}, false
+}
+
+var regionLocations = map[string]map[string]Location{
+	"aws": {
+		"af-south-1":     {"ZA", "Cape Town"},
+		"ap-east-1":      {"HK", "Hong Kong"},
+		"ap-east-2":      {"TW", "Taipei"},
+		"ap-northeast-1": {"JP", "Tokyo"},
+		"ap-northeast-2": {"KR", "Seoul"},
+		"ap-northeast-3": {"JP", "Osaka"},
+		"ap-south-1":     {"IN", "Mumbai"},
+		"ap-south-2":     {"IN", "Hyderabad"},
+		"ap-southeast-1": {"SG", "Singapore"},
+		"ap-southeast-2": {"AU", "Sydney"},
+		"ap-southeast-3": {"ID", "Jakarta"},
+		"ap-southeast-4": {"AU", "Melbourne"},
+		"ap-southeast-5": {"MY", "Kuala Lumpur"},
+		"ap-southeast-7": {"TH", "Bangkok"},
+		"ca-central-1":   {"CA", "Montreal"},
+		"ca-west-1":      {"CA", "Calgary"},
+		"eu-central-1":   {"DE", "Frankfurt"},
+		"eu-central-2":   {"CH", "Zurich"},
+		"eu-north-1":     {"SE", "Stockholm"},
+		"eu-south-1":     {"IT", "Milan"},
+		"eu-south-2":     {"ES", "Zaragoza"},
+		"eu-west-1":      {"IE", "Dublin"},
+		"eu-west-2":      {"GB", "London"},
+		"eu-west-3":      {"FR", "Paris"},
+		"il-central-1":   {"IL", "Tel Aviv"},
+		"me-central-1":   {"AE", "Dubai"},
+		"me-south-1":     {"BH", "Manama"},
+		"mx-central-1":   {"MX", "Queretaro"},
+		"sa-east-1":      {"BR", "Sao Paulo"},
+		"us-east-1":      {"US", "Ashburn"},
+		"us-east-2":      {"US", "Columbus"},
+		"us-west-1":      {"US", "San Francisco"},
+		"us-west-2":      {"US", "Portland"},
+	},
+	"gce": {
+		"africa-south1":           {"ZA", "Johannesburg"},
+		"asia-east1":              {"TW", "Changhua"},
+		"asia-east2":              {"HK", "Hong Kong"},
+		"asia-northeast1":         {"JP", "Tokyo"},
+		"asia-northeast2":         {"JP", "Osaka"},
+		"asia-northeast3":         {"KR", "Seoul"},
+		"asia-south1":             {"IN", "Mumbai"},
+		"asia-south2":             {"IN", "Delhi"},
+		"asia-southeast1":         {"SG", "Singapore"},
+		"asia-southeast2":         {"ID", "Jakarta"},
+		"australia-southeast1":    {"AU", "Sydney"},
+		"australia-southeast2":    {"AU", "Melbourne"},
+		"europe-central2":         {"PL", "Warsaw"},
+		"europe-north1":           {"FI", "Hamina"},
+		"europe-north2":           {"SE", "Stockholm"},
+		"europe-southwest1":       {"ES", "Madrid"},
+		"europe-west1":            {"BE", "St. Ghislain"},
+		"europe-west10":           {"DE", "Berlin"},
+		"europe-west12":           {"IT", "Turin"},
+		"europe-west2":            {"GB", "London"},
+		"europe-west3":            {"DE", "Frankfurt"},
+		"europe-west4":            {"NL", "Eemshaven"},
+		"europe-west6":            {"CH", "Zurich"},
+		"europe-west8":            {"IT", "Milan"},
+		"europe-west9":            {"FR", "Paris"},
+		"me-central1":             {"QA", "Doha"},
+		"me-central2":             {"SA", "Dammam"},
+		"me-west1":                {"IL", "Tel Aviv"},
+		"northamerica-northeast1": {"CA", "Montreal"},
+		"northamerica-northeast2": {"CA", "Toronto"},
+		"northamerica-south1":     {"MX", "Queretaro"},
+		"southamerica-east1":      {"BR", "Sao Paulo"},
+		"southamerica-west1":      {"CL", "Santiago"},
+		"us-central1":             {"US", "Council Bluffs"},
+		"us-east1":                {"US", "Moncks Corner"},
+		"us-east4":                {"US", "Ashburn"},
+		"us-east5":                {"US", "Columbus"},
+		"us-south1":               {"US", "Dallas"},
+		"us-west1":                {"US", "The Dalles"},
+		"us-west2":                {"US", "Los Angeles"},
+		"us-west3":                {"US", "Salt Lake City"},
+		"us-west4":                {"US", "Las Vegas"},
+	},
+	"hetzner": {
+		"ash":  {"US", "Ashburn"},
+		"fsn1": {"DE", "Falkenstein"},
+		"hel1": {"FI", "Helsinki"},
+		"hil":  {"US", "Hillsboro"},
+		"nbg1": {"DE", "Nuremberg"},
+		"sin":  {"SG", "Singapore"},
+	},
+	"digitalocean": {
+		"ams2": {"NL", "Amsterdam"},
+		"ams3": {"NL", "Amsterdam"},
+		"atl1": {"US", "Atlanta"},
+		"blr1": {"IN", "Bangalore"},
+		"fra1": {"DE", "Frankfurt"},
+		"lon1": {"GB", "London"},
+		"nyc1": {"US", "New York"},
+		"nyc2": {"US", "New York"},
+		"nyc3": {"US", "New York"},
+		"sfo1": {"US", "San Francisco"},
+		"sfo2": {"US", "San Francisco"},
+		"sfo3": {"US", "San Francisco"},
+		"sgp1": {"SG", "Singapore"},
+		"syd1": {"AU", "Sydney"},
+		"tor1": {"CA", "Toronto"},
+	},
+	// Azure only publishes the state of some of its US regions.
+	"azure": {
+		"australiaeast":      {"AU", "Sydney"},
+		"australiasoutheast": {"AU", "Melbourne"},
+		"brazilsouth":        {"BR", "Sao Paulo"},
+		"canadacentral":      {"CA", "Toronto"},
+		"canadaeast":         {"CA", "Quebec City"},
+		"centralindia":       {"IN", "Pune"},
+		"centralus":          {"US", "Iowa"},
+		"eastasia":           {"HK", "Hong Kong"},
+		"eastus":             {"US", "Virginia"},
+		"eastus2":            {"US", "Virginia"},
+		"francecentral":      {"FR", "Paris"},
+		"germanywestcentral": {"DE", "Frankfurt"},
+		"israelcentral":      {"IL", "Tel Aviv"},
+		"italynorth":         {"IT", "Milan"},
+		"japaneast":          {"JP", "Tokyo"},
+		"japanwest":          {"JP", "Osaka"},
+		"koreacentral":       {"KR", "Seoul"},
+		"mexicocentral":      {"MX", "Queretaro"},
+		"northcentralus":     {"US", "Illinois"},
+		"northeurope":        {"IE", "Dublin"},
+		"norwayeast":         {"NO", "Oslo"},
+		"polandcentral":      {"PL", "Warsaw"},
+		"qatarcentral":       {"QA", "Doha"},
+		"southafricanorth":   {"ZA", "Johannesburg"},
+		"southcentralus":     {"US", "Texas"},
+		"southeastasia":      {"SG", "Singapore"},
+		"southindia":         {"IN", "Chennai"},
+		"spaincentral":       {"ES", "Madrid"},
+		"swedencentral":      {"SE", "Gavle"},
+		"switzerlandnorth":   {"CH", "Zurich"},
+		"uaenorth":           {"AE", "Dubai"},
+		"uksouth":            {"GB", "London"},
+		"ukwest":             {"GB", "Cardiff"},
+		"westcentralus":      {"US", "Wyoming"},
+		"westeurope":         {"NL", "Amsterdam"},
+		"westus":             {"US", "California"},
+		"westus2":            {"US", "Washington"},
+		"westus3":            {"US", "Phoenix"},
+	},
+}
+
+var countryNames = map[string]string{
+	"AE": "United Arab Emirates",
+	"AU": "Australia",
+	"BE": "Belgium",
+	"BH": "Bahrain",
+	"BR": "Brazil",
+	"CA": "Canada",
+	"CH": "Switzerland",
+	"CL": "Chile",
+	"DE": "Germany",
+	"ES": "Spain",
+	"FI": "Finland",
+	"FR": "France",
+	"GB": "United Kingdom",
+	"HK": "Hong Kong",
+	"ID": "Indonesia",
+	"IE": "Ireland",
+	"IL": "Israel",
+	"IN": "India",
+	"IT": "Italy",
+	"JP": "Japan",
+	"KR": "South Korea",
+	"MX": "Mexico",
+	"MY": "Malaysia",
+	"NL": "Netherlands",
+	"NO": "Norway",
+	"PL": "Poland",
+	"QA": "Qatar",
+	"SA": "Saudi Arabia",
+	"SE": "Sweden",
+	"SG": "Singapore",
+	"TH": "Thailand",
+	"TW": "Taiwan",
+	"US": "United States",
+	"ZA": "South Africa",
+}
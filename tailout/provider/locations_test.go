@@ -0,0 +1,69 @@
+package provider
+
+import "testing"
+
+func TestRegionLocation(t *testing.T) {
+	tests := []struct {
+		provider string
+		region   string
+		want     Location
+		found    bool
+	}{
+		{"aws", "eu-west-3", Location{"FR", "Paris"}, true},
+		{"gce", "europe-west1", Location{"BE", "St. Ghislain"}, true},
+		{"gce", "europe-west1-b", Location{"BE", "St. Ghislain"}, true},
+		{"hetzner", "fsn1", Location{"DE", "Falkenstein"}, true},
+		{"digitalocean", "nyc1", Location{"US", "New York"}, true},
+		{"azure", "westeurope", Location{"NL", "Amsterdam"}, true},
+		{"aws", "eu-west-42", Location{}, false},
+		{"aws", "fsn1", Location{}, false},
+		{"docker", "local", Location{}, false},
+		{"unknown", "eu-west-3", Location{}, false},
+	}
+	for _, tt := range tests {
+		location, found := RegionLocation(tt.provider, tt.region)
+		if location != tt.want || found != tt.found {
+			t.Errorf("RegionLocation(%q, %q) = %v, %v, want %v, %v", tt.provider, tt.region, location, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestLocationMatches(t *testing.T) {
+	paris := Location{"FR", "Paris"}
+	tests := []struct {
+		country string
+		city    string
+		want    bool
+	}{
+		{"", "", true},
+		{"FR", "", true},
+		{"fr", "", true},
+		{"France", "", true},
+		{"france", "paris", true},
+		{"", "Paris", true},
+		{"DE", "", false},
+		{"Germany", "Paris", false},
+		{"FR", "Marseille", false},
+		{"", "Par", false},
+	}
+	for _, tt := range tests {
+		if got := paris.Matches(tt.country, tt.city); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.country, tt.city, got, tt.want)
+		}
+	}
+}
+
+func TestLocationString(t *testing.T) {
+	tests := []struct {
+		location Location
+		want     string
+	}{
+		{Location{"FR", "Paris"}, "Paris, France"},
+		{Location{"XX", "Nowhere"}, "Nowhere, XX"},
+	}
+	for _, tt := range tests {
+		if got := tt.location.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
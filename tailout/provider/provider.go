@@ -0,0 +1,292 @@
+// Package provider abstracts the cloud platforms tailout can run exit nodes on.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/tailout/config"
+)
+
+// ErrDryRun is returned by providers without a native dry run mode when a
+// change was requested in dry run mode.
+var ErrDryRun = errors.New("dry run mode, no changes made")
+
+// Image is a machine image an exit node can be booted from.
+type Image struct {
+	ID   string
+	Name string
+}
+
+// Instance is a machine launched by a provider.
+type Instance struct {
+	ID           string
+	Region       string
+	PublicIP     string
+	InstanceType string
+	Market       string
+	// CreatedAt is when the machine was created, zero when unknown.
+	CreatedAt time.Time
+	// Stopped is set for machines that are powered off but not deleted,
+	// which most providers keep billing for their disk or reservation.
+	Stopped bool
+	// Tags are the tags of the machine, as returned by the provider. Providers
+	// that only accept lowercase labels return them sanitized.
+	Tags map[string]string
+}
+
+// Tags tailout attaches to the machines it launches.
+const (
+	TagApp         = "App"
+	TagName        = "Name"
+	TagTailscaleIP = "tailout:tailscale-ip"
+	// TagExpiresAt holds the Unix time at which the machine shuts down, in
+	// seconds since digits survive the sanitization of labels, or
+	// ExpiresNever.
+	TagExpiresAt = "tailout:expires-at"
+)
+
+// ExpiresNever is the value of TagExpiresAt for machines that do not shut
+// down on their own.
+const ExpiresNever = "never"
+
+// Tag returns the value of the tag key of the instance, looking it up by its
+// sanitized name for providers that only accept lowercase labels.
+func (i Instance) Tag(key string) string {
+	if value, ok := i.Tags[key]; ok {
+		return value
+	}
+	return i.Tags[sanitizeLabel(key)]
+}
+
+// ExpiresAt returns the time at which the instance shuts down, if known.
+func (i Instance) ExpiresAt() (time.Time, bool) {
+	seconds, err := strconv.ParseInt(i.Tag(TagExpiresAt), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// Persistent reports whether the instance does not shut down on its own.
+func (i Instance) Persistent() bool {
+	return i.Tag(TagExpiresAt) == ExpiresNever
+}
+
+// HasTag reports whether the instance has the tag key set to value, ignoring
+// the sanitization done by providers that only accept lowercase labels.
+func (i Instance) HasTag(key, value string) bool {
+	tag := i.Tag(key)
+	return tag != "" && sanitizeLabel(tag) == sanitizeLabel(value)
+}
+
+// Purchasing options of the machines, only supported by the AWS provider.
+const (
+	MarketSpot             = "spot"
+	MarketOnDemand         = "on-demand"
+	MarketSpotThenOnDemand = "spot-then-on-demand"
+)
+
+// ValidateMarket returns an error if market is not a known purchasing option.
+func ValidateMarket(market string) error {
+	switch market {
+	case "", MarketSpot, MarketOnDemand, MarketSpotThenOnDemand:
+		return nil
+	default:
+		return fmt.Errorf("unknown market %q, must be one of %s, %s or %s", market, MarketSpot, MarketOnDemand, MarketSpotThenOnDemand)
+	}
+}
+
+// LaunchInput describes the machine to launch.
+type LaunchInput struct {
+	Region       string
+	Image        Image
+	InstanceType string
+	// FallbackInstanceTypes are tried in order when InstanceType has no
+	// capacity left.
+	FallbackInstanceTypes []string
+	// Market is the purchasing option of the machine, spot by default.
+	Market string
+	// UserData is the bootstrap script run by the machine on first boot.
+	UserData string
+	// AuthKey, TailscaleArgs and Shutdown are used instead of UserData by
+	// providers that run tailscale without booting a machine. Shutdown is
+	// zero for machines that never shut down.
+	AuthKey       string
+	TailscaleArgs []string
+	Shutdown      time.Duration
+	// IdleTimeout is set when UserData shuts the machine down once idle.
+	IdleTimeout time.Duration
+	// Tags are attached to the machine when it is created.
+	Tags   map[string]string
+	DryRun bool
+}
+
+// Provider is implemented by every cloud platform tailout can launch exit
+// nodes on.
+type Provider interface {
+	// Name returns the name of the provider, as used in the configuration.
+	Name() string
+	// Account returns a human readable description of the account used.
+	Account(ctx context.Context) (string, error)
+	// Regions returns the regions available to the account.
+	Regions(ctx context.Context) ([]string, error)
+	// DefaultInstanceType returns the machine size used when none is configured.
+	DefaultInstanceType() string
+	// FindImage returns the image exit nodes of the given instance type should
+	// be booted from.
+	FindImage(ctx context.Context, region, instanceType string) (Image, error)
+	// SetupScript returns shell commands run as root at the start of the
+	// bootstrap script. They install the packages the bootstrap needs and set
+	// the INSTANCE_ID variable to the ID of the machine they are running on.
+	SetupScript() string
+	// Launch creates a machine and returns as soon as it has an ID.
+	Launch(ctx context.Context, input LaunchInput) (Instance, error)
+	// Tag adds or replaces tags on a machine.
+	Tag(ctx context.Context, region, id string, tags map[string]string) error
+	// WaitRunning blocks until the machine is running.
+	WaitRunning(ctx context.Context, region, id string) error
+	// PublicIP returns the public IP address of a machine.
+	PublicIP(ctx context.Context, region, id string) (string, error)
+	// Terminate destroys a machine.
+	Terminate(ctx context.Context, region, id string, dryRun bool) error
+	// List returns the machines tagged App=tailout that are not terminated,
+	// including powered off ones, in every region.
+	List(ctx context.Context) ([]Instance, error)
+}
+
+// BillingIncrementer is implemented by providers that bill machines for every
+// started increment of time rather than by the second.
+type BillingIncrementer interface {
+	BillingIncrement() time.Duration
+}
+
+// InterruptionNotifier is implemented by providers that warn spot machines
+// shortly before reclaiming them.
+type InterruptionNotifier interface {
+	// InterruptionCheck returns shell commands, run on the machine, that
+	// exit with status 0 once it has been warned that it is about to be
+	// reclaimed.
+	InterruptionCheck() string
+}
+
+// RegionEndpointer is implemented by providers with a public endpoint in each
+// region, used to measure the latency to the region.
+type RegionEndpointer interface {
+	// RegionEndpoint returns the host:port of the endpoint of the region.
+	RegionEndpoint(region string) string
+}
+
+// SpotPricer is implemented by providers with a spot market whose price
+// changes over time.
+type SpotPricer interface {
+	// SpotPrice returns the lowest current hourly price of the instance
+	// type in the region, in US dollars.
+	SpotPrice(ctx context.Context, region, instanceType string) (float64, error)
+}
+
+// ResourceCollector is implemented by providers creating resources alongside
+// machines, which are left behind by machines deleting themselves.
+type ResourceCollector interface {
+	// CollectResources deletes the resources created by tailout that no
+	// machine uses anymore, or only lists them in dry run mode, and returns
+	// a description of each of them.
+	CollectResources(ctx context.Context, dryRun bool) ([]string, error)
+}
+
+// ExpiryEnforcer is implemented by providers shutting machines down at the
+// expiry set with the TagExpiresAt tag, rather than with a job scheduled by
+// the bootstrap script.
+type ExpiryEnforcer interface {
+	EnforcesExpiry() bool
+}
+
+// Secret is a value stored by a provider for a machine to fetch at boot.
+type Secret struct {
+	ID string
+	// Script holds shell commands setting the AUTH_KEY variable to the
+	// value of the secret, run by the machine at boot.
+	Script string
+}
+
+// SecretStorer is implemented by providers able to hand the auth key to a
+// machine without writing it in its user data.
+type SecretStorer interface {
+	// StoresSecrets reports whether a secret store is configured.
+	StoresSecrets() bool
+	StoreSecret(ctx context.Context, region, value string) (Secret, error)
+	DeleteSecret(ctx context.Context, region string, secret Secret) error
+}
+
+// New returns the provider selected by the configuration.
+func New(c *config.Config) (Provider, error) {
+	switch c.Provider {
+	case "", "aws":
+		return NewAWS(c.AWS), nil
+	case "gce":
+		return NewGCE(c.GCE), nil
+	case "hetzner":
+		return NewHetzner(c.Hetzner), nil
+	case "digitalocean":
+		return NewDigitalOcean(c.DigitalOcean), nil
+	case "azure":
+		return NewAzure(c.Azure), nil
+	case "docker":
+		return NewDocker(c.Docker), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q", c.Provider)
+	}
+}
+
+// NodeName returns the tailnet hostname of the node running on the instance.
+func NodeName(region, id string) string {
+	return fmt.Sprintf("tailout-%s-%s", region, id)
+}
+
+// poll calls check every interval until it reports done, returns an error or
+// the timeout expires.
+func poll(ctx context.Context, timeout, interval time.Duration, check func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout after %s: %w", timeout, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sanitizeLabels converts tags to labels made of lowercase letters, digits,
+// dashes and underscores, which every provider accepts.
+func sanitizeLabels(tags map[string]string) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for key, value := range tags {
+		labels[sanitizeLabel(key)] = sanitizeLabel(value)
+	}
+	return labels
+}
+
+func sanitizeLabel(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.ToLower(s))
+}
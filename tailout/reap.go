@@ -0,0 +1,80 @@
+package tailout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+// reapGracePeriod is how long after its expiry an instance is given to shut
+// itself down before it is reaped.
+const reapGracePeriod = 5 * time.Minute
+
+// Reap terminates the tailout instances of every region that are past the
+// expiry recorded in their tailout:expires-at tag, in case they failed to
+// shut themselves down, and the ones that powered themselves off without
+// being deleted, which providers keep billing. The resources these instances
+// left behind are deleted too. It does not ask for confirmation so that it
+// can run unattended.
+func (app *App) Reap() error {
+	dryRun := app.Config.DryRun
+
+	cloud, err := app.provider()
+	if err != nil {
+		return err
+	}
+
+	instances, err := cloud.List(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	expired := []provider.Instance{}
+	for _, instance := range instances {
+		expiresAt, ok := instance.ExpiresAt()
+		if (ok && time.Since(expiresAt) > reapGracePeriod) || (instance.Stopped && !instance.Persistent()) {
+			expired = append(expired, instance)
+		}
+	}
+
+	if len(expired) == 0 {
+		fmt.Fprintln(app.Err, "No expired instance found")
+	}
+
+	var errs []error
+	for _, instance := range expired {
+		reason := "powered off"
+		if expiresAt, ok := instance.ExpiresAt(); ok && time.Since(expiresAt) > reapGracePeriod {
+			reason = "expired at " + expiresAt.Format(time.RFC3339)
+		}
+		if dryRun {
+			fmt.Fprintln(app.Out, "Would terminate instance", instance.ID, "in", instance.Region+",", reason)
+			continue
+		}
+
+		if err := cloud.Terminate(context.TODO(), instance.Region, instance.ID, false); err != nil {
+			errs = append(errs, fmt.Errorf("failed to terminate instance %s: %w", instance.ID, err))
+			continue
+		}
+		fmt.Fprintln(app.Out, "Terminated instance", instance.ID, "in", instance.Region+",", reason)
+	}
+
+	if collector, ok := cloud.(provider.ResourceCollector); ok {
+		collected, err := collector.CollectResources(context.TODO(), dryRun)
+		for _, resource := range collected {
+			if dryRun {
+				fmt.Fprintln(app.Out, "Would delete unused", resource)
+			} else {
+				fmt.Fprintln(app.Out, "Deleted unused", resource)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete unused resources: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package tailout
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+func TestReap(t *testing.T) {
+	expiresAt := func(d time.Duration) map[string]string {
+		return map[string]string{provider.TagExpiresAt: strconv.FormatInt(time.Now().Add(d).Unix(), 10)}
+	}
+	never := map[string]string{provider.TagExpiresAt: provider.ExpiresNever}
+
+	app, cloud, _ := newFakeApp()
+	cloud.instances = []provider.Instance{
+		{ID: "expired", Region: "fake-1", Tags: expiresAt(-time.Hour)},
+		{ID: "in-grace-period", Region: "fake-1", Tags: expiresAt(-time.Minute)},
+		{ID: "running", Region: "fake-1", Tags: expiresAt(time.Hour)},
+		{ID: "powered-off", Region: "fake-1", Stopped: true, Tags: expiresAt(time.Hour)},
+		{ID: "persistent", Region: "fake-1", Tags: never},
+		{ID: "persistent-powered-off", Region: "fake-1", Stopped: true, Tags: never},
+	}
+
+	if err := app.Reap(); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(cloud.terminated)
+	if want := []string{"expired", "powered-off"}; !slices.Equal(cloud.terminated, want) {
+		t.Errorf("terminated %v, want %v", cloud.terminated, want)
+	}
+}
@@ -0,0 +1,260 @@
+package tailout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+// autoRegion is the region name picking the best ranked region.
+const autoRegion = "auto"
+
+const (
+	// latencyProbes is the number of connections opened to measure the
+	// latency to a region, the fastest of which is kept.
+	latencyProbes = 3
+	// latencyTimeout is how long a connection to a region may take before
+	// the region is considered unreachable.
+	latencyTimeout = 3 * time.Second
+)
+
+// regionRank is the latency and spot price measured for a region.
+type regionRank struct {
+	Region    string             `json:"region" yaml:"region"`
+	Location  *provider.Location `json:"location,omitempty" yaml:"location,omitempty"`
+	Latency   string             `json:"latency,omitempty" yaml:"latency,omitempty"`
+	SpotPrice *float64           `json:"spot_price,omitempty" yaml:"spot_price,omitempty"`
+	// Score is the weighted mix of latency and price relative to the other
+	// regions, lower is better. It is not set when a measurement failed.
+	Score *float64 `json:"score,omitempty" yaml:"score,omitempty"`
+
+	latency time.Duration
+}
+
+type regionsResult struct {
+	Provider     string       `json:"provider" yaml:"provider"`
+	InstanceType string       `json:"instance_type,omitempty" yaml:"instance_type,omitempty"`
+	PriceWeight  float64      `json:"price_weight" yaml:"price_weight"`
+	Regions      []regionRank `json:"regions" yaml:"regions"`
+}
+
+// Regions ranks the regions of the provider by latency, spot price or a
+// weighted mix of both.
+func (app *App) Regions() error {
+	cloud, err := app.provider()
+	if err != nil {
+		return err
+	}
+
+	instanceType := app.Config.Create.InstanceType
+	if instanceType == "" {
+		instanceType = cloud.DefaultInstanceType()
+	}
+
+	regions, err := app.candidateRegions(context.TODO(), cloud)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(app.Err, "Measuring regions...")
+	ranks, err := app.rankRegions(context.TODO(), cloud, regions, instanceType)
+	if err != nil {
+		return err
+	}
+
+	result := regionsResult{
+		Provider:    cloud.Name(),
+		PriceWeight: app.Config.Regions.PriceWeight,
+		Regions:     ranks,
+	}
+	if result.PriceWeight > 0 {
+		result.InstanceType = instanceType
+	}
+
+	if app.structuredOutput() {
+		return app.printResult(result)
+	}
+
+	for i, rank := range ranks {
+		position := strconv.Itoa(i+1) + "."
+		if rank.Score == nil {
+			position = "-"
+		}
+		location := ""
+		if rank.Location != nil {
+			location = rank.Location.String()
+		}
+		fmt.Fprintf(app.Out, "%-4s %-24s %-32s %s\n", position, rank.Region, location, rank.describe())
+	}
+	return nil
+}
+
+// describe returns the measurements of the region as text.
+func (r regionRank) describe() string {
+	latency := "unreachable"
+	if r.Latency != "" {
+		latency = r.Latency
+	}
+	if r.SpotPrice == nil {
+		return latency
+	}
+	return fmt.Sprintf("%s, $%.4f/h", latency, *r.SpotPrice)
+}
+
+// rankRegions measures the latency to the regions, and the spot price of the
+// instance type in each of them when the price weight is set, and sorts them
+// from best to worst. Regions missing a measurement are sorted last.
+func (app *App) rankRegions(ctx context.Context, cloud provider.Provider, regions []string, instanceType string) ([]regionRank, error) {
+	priceWeight := app.Config.Regions.PriceWeight
+	if priceWeight < 0 || priceWeight > 1 {
+		return nil, errors.New("price weight must be between 0 and 1")
+	}
+
+	endpointer, measureLatency := cloud.(provider.RegionEndpointer)
+	if priceWeight < 1 && !measureLatency {
+		return nil, fmt.Errorf("cannot measure the latency to the regions of %s, rank them by price with a price weight of 1", cloud.Name())
+	}
+	pricer, measurePrice := cloud.(provider.SpotPricer)
+	if priceWeight > 0 && !measurePrice {
+		return nil, fmt.Errorf("%s has no spot prices, rank its regions by latency with a price weight of 0", cloud.Name())
+	}
+	measurePrice = priceWeight > 0
+	measureLatency = priceWeight < 1
+
+	ranks := make([]regionRank, len(regions))
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		ranks[i].Region = region
+		if location, ok := provider.RegionLocation(cloud.Name(), region); ok {
+			ranks[i].Location = &location
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if measureLatency {
+				if latency, err := probeLatency(ctx, endpointer.RegionEndpoint(region)); err == nil {
+					ranks[i].latency = latency
+					ranks[i].Latency = latency.Round(time.Millisecond).String()
+				}
+			}
+			if measurePrice {
+				if price, err := pricer.SpotPrice(ctx, region, instanceType); err == nil {
+					ranks[i].SpotPrice = &price
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Scores are relative to the worst measurement so that latency and price
+	// can be mixed.
+	var maxLatency time.Duration
+	var maxPrice float64
+	for _, rank := range ranks {
+		maxLatency = max(maxLatency, rank.latency)
+		if rank.SpotPrice != nil {
+			maxPrice = max(maxPrice, *rank.SpotPrice)
+		}
+	}
+
+	scored := 0
+	for i, rank := range ranks {
+		if (measureLatency && rank.Latency == "") || (measurePrice && rank.SpotPrice == nil) {
+			continue
+		}
+		var score float64
+		if measureLatency && maxLatency > 0 {
+			score += (1 - priceWeight) * float64(rank.latency) / float64(maxLatency)
+		}
+		if measurePrice && maxPrice > 0 {
+			score += priceWeight * *rank.SpotPrice / maxPrice
+		}
+		ranks[i].Score = &score
+		scored++
+	}
+	if scored == 0 {
+		return nil, errors.New("failed to measure any region")
+	}
+
+	sort.SliceStable(ranks, func(i, j int) bool {
+		switch {
+		case ranks[i].Score == nil:
+			return false
+		case ranks[j].Score == nil:
+			return true
+		default:
+			return *ranks[i].Score < *ranks[j].Score
+		}
+	})
+
+	return ranks, nil
+}
+
+// candidateRegions returns the regions of the provider in the configured
+// country and city.
+func (app *App) candidateRegions(ctx context.Context, cloud provider.Provider) ([]string, error) {
+	regions, err := cloud.Regions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve regions: %w", err)
+	}
+
+	country, city := app.Config.Country, app.Config.City
+	if country == "" && city == "" {
+		return regions, nil
+	}
+
+	matching := []string{}
+	for _, region := range regions {
+		location, ok := provider.RegionLocation(cloud.Name(), region)
+		if ok && location.Matches(country, city) {
+			matching = append(matching, region)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("no region of %s found in %s", cloud.Name(), app.requestedLocation())
+	}
+
+	return matching, nil
+}
+
+// requestedLocation returns the configured country and city as text.
+func (app *App) requestedLocation() string {
+	parts := []string{}
+	for _, part := range []string{app.Config.City, app.Config.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// probeLatency returns the fastest of latencyProbes TCP connections to the
+// address.
+func probeLatency(ctx context.Context, address string) (time.Duration, error) {
+	dialer := net.Dialer{Timeout: latencyTimeout}
+
+	var fastest time.Duration
+	for range latencyProbes {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return 0, fmt.Errorf("failed to connect to %s: %w", address, err)
+		}
+		latency := time.Since(start)
+		conn.Close()
+
+		if fastest == 0 || latency < fastest {
+			fastest = latency
+		}
+	}
+
+	return fastest, nil
+}
@@ -0,0 +1,162 @@
+package tailout
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+// fakeRegionProvider measures its regions against local listeners, and has
+// fixed spot prices.
+type fakeRegionProvider struct {
+	*fakeProvider
+	endpoints map[string]string
+	prices    map[string]float64
+}
+
+func (p *fakeRegionProvider) RegionEndpoint(region string) string {
+	return p.endpoints[region]
+}
+
+func (p *fakeRegionProvider) SpotPrice(ctx context.Context, region, instanceType string) (float64, error) {
+	price, ok := p.prices[region]
+	if !ok {
+		return 0, errors.New("no spot price")
+	}
+	return price, nil
+}
+
+// listen returns the address of a local listener, closed with the test.
+func listen(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+// unreachable returns the address of a closed local listener.
+func unreachable(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestRankRegions(t *testing.T) {
+	regions := []string{"fake-1", "fake-2", "fake-3"}
+	tests := []struct {
+		name        string
+		priceWeight float64
+		endpoints   map[string]string
+		prices      map[string]float64
+		want        []string
+		unscored    int
+	}{
+		{
+			name:        "price",
+			priceWeight: 1,
+			prices:      map[string]float64{"fake-1": 0.03, "fake-2": 0.01, "fake-3": 0.02},
+			want:        []string{"fake-2", "fake-3", "fake-1"},
+		},
+		{
+			name:        "missing price",
+			priceWeight: 1,
+			prices:      map[string]float64{"fake-1": 0.03, "fake-3": 0.02},
+			want:        []string{"fake-3", "fake-1", "fake-2"},
+			unscored:    1,
+		},
+		{
+			name:        "unreachable region",
+			priceWeight: 0,
+			endpoints:   map[string]string{"fake-1": "unreachable", "fake-2": "reachable", "fake-3": "unreachable"},
+			want:        []string{"fake-2", "fake-1", "fake-3"},
+			unscored:    2,
+		},
+		{
+			name:        "price and latency",
+			priceWeight: 0.5,
+			endpoints:   map[string]string{"fake-1": "reachable", "fake-2": "unreachable", "fake-3": "reachable"},
+			prices:      map[string]float64{"fake-1": 0.03, "fake-2": 0.01, "fake-3": 0.02},
+			want:        []string{"", "", "fake-2"},
+			unscored:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, _ := newFakeApp()
+			app.Config.Regions.PriceWeight = tt.priceWeight
+
+			endpoints := map[string]string{}
+			for region, state := range tt.endpoints {
+				if state == "reachable" {
+					endpoints[region] = listen(t)
+				} else {
+					endpoints[region] = unreachable(t)
+				}
+			}
+			regionCloud := &fakeRegionProvider{fakeProvider: cloud, endpoints: endpoints, prices: tt.prices}
+
+			ranks, err := app.rankRegions(context.Background(), regionCloud, regions, "small")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unscored := 0
+			for i, rank := range ranks {
+				if tt.want[i] != "" && rank.Region != tt.want[i] {
+					t.Errorf("rank %d is %s, want %s", i+1, rank.Region, tt.want[i])
+				}
+				if rank.Score == nil {
+					unscored++
+				} else if unscored > 0 {
+					t.Errorf("scored region %s ranked after an unscored one", rank.Region)
+				}
+				if rank.Location != nil {
+					t.Errorf("unexpected location %v for region %s", rank.Location, rank.Region)
+				}
+			}
+			if unscored != tt.unscored {
+				t.Errorf("%d unscored regions, want %d", unscored, tt.unscored)
+			}
+		})
+	}
+}
+
+func TestRankRegionsErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		priceWeight float64
+		measurable  bool
+	}{
+		{"negative price weight", -0.5, true},
+		{"price weight above 1", 1.5, true},
+		{"no latency endpoint", 0, false},
+		{"no spot price", 0.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, cloud, _ := newFakeApp()
+			app.Config.Regions.PriceWeight = tt.priceWeight
+
+			var cloudProvider provider.Provider = cloud
+			if tt.measurable {
+				cloudProvider = &fakeRegionProvider{fakeProvider: cloud}
+			}
+
+			_, err := app.rankRegions(context.Background(), cloudProvider, []string{"fake-1"}, "small")
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
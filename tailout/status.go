@@ -6,27 +6,45 @@ import (
 	"io"
 	"net/http"
 	"net/netip"
-	"net/url"
 	"slices"
+	"time"
 
 	"github.com/cterence/tailout/internal"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
 	"tailscale.com/client/tailscale"
-	tsapi "tailscale.com/client/tailscale/v2"
 )
 
+// nodeStatus is the status of a tailout node.
+type nodeStatus struct {
+	Hostname   string             `json:"hostname" yaml:"hostname"`
+	Addresses  []string           `json:"addresses" yaml:"addresses"`
+	Region     string             `json:"region,omitempty" yaml:"region,omitempty"`
+	Location   *provider.Location `json:"location,omitempty" yaml:"location,omitempty"`
+	InstanceID string             `json:"instance_id,omitempty" yaml:"instance_id,omitempty"`
+	LastSeen   *time.Time         `json:"last_seen,omitempty" yaml:"last_seen,omitempty"`
+	Connected  bool               `json:"connected" yaml:"connected"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	// TTL is the time left before the node shuts down, or "never".
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// Persistent is set for nodes created or extended to never shut down.
+	Persistent bool `json:"persistent" yaml:"persistent"`
+	// Draining is set for nodes about to be reclaimed by their provider.
+	Draining bool `json:"draining" yaml:"draining"`
+}
+
+type statusResult struct {
+	Nodes    []nodeStatus `json:"nodes" yaml:"nodes"`
+	PublicIP string       `json:"public_ip" yaml:"public_ip"`
+}
+
 func (app *App) Status() error {
-	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
+	control, err := app.controlPlane()
 	if err != nil {
-		return fmt.Errorf("failed to parse base URL: %w", err)
+		return err
 	}
 
-	client := &tsapi.Client{
-		APIKey:  app.Config.Tailscale.APIKey,
-		Tailnet: app.Config.Tailscale.Tailnet,
-		BaseURL: baseURL,
-	}
-
-	nodes, err := internal.GetActiveNodes(client)
+	nodes, err := internal.GetActiveNodes(control)
 	if err != nil {
 		return fmt.Errorf("failed to get active nodes: %w", err)
 	}
@@ -37,26 +55,59 @@ func (app *App) Status() error {
 		return fmt.Errorf("failed to get tailscale preferences: %w", err)
 	}
 
-	var currentNode tsapi.Device
+	var currentNode controlplane.Node
 
 	if status.ExitNodeStatus != nil {
-		i := slices.IndexFunc(nodes, func(e tsapi.Device) bool {
+		i := slices.IndexFunc(nodes, func(e controlplane.Node) bool {
 			return netip.MustParsePrefix(e.Addresses[0]+"/32") == status.ExitNodeStatus.TailscaleIPs[0]
 		})
-		currentNode = nodes[i]
+		if i >= 0 {
+			currentNode = nodes[i]
+		}
 	}
 
-	if len(nodes) == 0 {
-		fmt.Println("No active node created by tailout found.")
-	} else {
-		fmt.Println("Active nodes created by tailout:")
-		for _, node := range nodes {
-			if currentNode.Hostname == node.Hostname {
-				fmt.Println("-", node.Hostname, "[Connected]")
-			} else {
-				fmt.Println("-", node.Hostname)
+	// The instances only add details to the nodes, so status still works
+	// without access to the cloud provider.
+	var instances []provider.Instance
+	var cloud provider.Provider
+	if len(nodes) > 0 {
+		cloud, err = app.provider()
+		if err == nil {
+			instances, err = cloud.List(context.TODO())
+		}
+		if err != nil {
+			fmt.Fprintln(app.Err, "Failed to list instances:", err)
+		}
+	}
+
+	result := statusResult{
+		Nodes: []nodeStatus{},
+	}
+	for _, node := range nodes {
+		nodeStatus := nodeStatus{
+			Hostname:  node.Hostname,
+			Addresses: node.Addresses,
+			LastSeen:  node.LastSeen,
+			Connected: currentNode.Hostname == node.Hostname,
+			Draining:  draining(node.Hostname),
+		}
+
+		if instance, found := findInstance(instances, node); found {
+			nodeStatus.Region = instance.Region
+			nodeStatus.InstanceID = instance.ID
+			if location, ok := provider.RegionLocation(cloud.Name(), instance.Region); ok {
+				nodeStatus.Location = &location
+			}
+			if expiresAt, ok := instance.ExpiresAt(); ok {
+				nodeStatus.ExpiresAt = &expiresAt
+				nodeStatus.TTL = max(time.Until(expiresAt), 0).Round(time.Second).String()
+			} else if instance.Persistent() {
+				nodeStatus.TTL = provider.ExpiresNever
+				nodeStatus.Persistent = true
 			}
 		}
+
+		result.Nodes = append(result.Nodes, nodeStatus)
 	}
 
 	// Query for the public IP address of this Node
@@ -75,7 +126,50 @@ func (app *App) Status() error {
 	if err != nil {
 		return fmt.Errorf("failed to get public IP: %w", err)
 	}
+	result.PublicIP = string(ipAddr)
+
+	if app.structuredOutput() {
+		return app.printResult(result)
+	}
+
+	if len(result.Nodes) == 0 {
+		fmt.Fprintln(app.Out, "No active node created by tailout found.")
+	} else {
+		fmt.Fprintln(app.Out, "Active nodes created by tailout:")
+		for _, node := range result.Nodes {
+			line := "- " + node.Hostname
+			if node.Location != nil {
+				line += " in " + node.Location.String()
+			}
+			switch {
+			case node.Persistent:
+				line += " (persistent)"
+			case node.TTL != "":
+				line += " (shuts down in " + node.TTL + ")"
+			}
+			if node.Draining {
+				line += " [Draining]"
+			}
+			if node.Connected {
+				line += " [Connected]"
+			}
+			fmt.Fprintln(app.Out, line)
+		}
+	}
+
+	fmt.Fprintln(app.Out, "Public IP: "+result.PublicIP)
 
-	fmt.Println("Public IP: " + string(ipAddr))
+	// Move off the exit node in use before its provider reclaims it.
+	if draining(currentNode.Hostname) && !app.Config.NonInteractive {
+		fmt.Fprintln(app.Out)
+		result, err := internal.PromptYesNo("Node " + currentNode.Hostname + " is about to be reclaimed. Do you want to move to another node?")
+		if err != nil {
+			return fmt.Errorf("failed to prompt for confirmation: %w", err)
+		}
+
+		if result {
+			return app.failover(control, currentNode, true)
+		}
+	}
 	return nil
 }
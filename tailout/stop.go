@@ -4,44 +4,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"net/url"
-	"regexp"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/cterence/tailout/internal"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
 	"github.com/ktr0731/go-fuzzyfinder"
-	tsapi "tailscale.com/client/tailscale/v2"
 )
 
+// stoppedNode is the result of stop for a node.
+type stoppedNode struct {
+	Hostname   string `json:"hostname" yaml:"hostname"`
+	Region     string `json:"region,omitempty" yaml:"region,omitempty"`
+	InstanceID string `json:"instance_id,omitempty" yaml:"instance_id,omitempty"`
+	Terminated bool   `json:"terminated" yaml:"terminated"`
+	Deleted    bool   `json:"deleted" yaml:"deleted"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
 func (app *App) Stop(args []string) error {
 	nonInteractive := app.Config.NonInteractive
 	dryRun := app.Config.DryRun
 	stopAll := app.Config.Stop.All
 
-	nodesToStop := []tsapi.Device{}
+	nodesToStop := []controlplane.Node{}
 
-	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
+	control, err := app.controlPlane()
 	if err != nil {
-		return fmt.Errorf("failed to parse base URL: %w", err)
+		return err
 	}
 
-	client := &tsapi.Client{
-		APIKey:  app.Config.Tailscale.APIKey,
-		Tailnet: app.Config.Tailscale.Tailnet,
-		BaseURL: baseURL,
-	}
-
-	tailoutNodes, err := internal.GetActiveNodes(client)
+	tailoutNodes, err := internal.GetActiveNodes(control)
 	if err != nil {
 		return fmt.Errorf("failed to get active nodes: %w", err)
 	}
 
 	if len(tailoutNodes) == 0 {
-		fmt.Println("No tailout node found in your tailnet")
+		fmt.Fprintln(app.Err, "No tailout node found in your tailnet")
+		if app.structuredOutput() {
+			return app.printResult([]stoppedNode{})
+		}
 		return nil
 	}
 
@@ -54,7 +56,7 @@ func (app *App) Stop(args []string) error {
 			return fmt.Errorf("failed to find node: %w", err)
 		}
 
-		nodesToStop = []tsapi.Device{}
+		nodesToStop = []controlplane.Node{}
 		for _, i := range idx {
 			nodesToStop = append(nodesToStop, tailoutNodes[i])
 		}
@@ -73,9 +75,9 @@ func (app *App) Stop(args []string) error {
 	}
 
 	if !nonInteractive {
-		fmt.Println("The following nodes will be stopped:")
+		fmt.Fprintln(app.Err, "The following nodes will be stopped:")
 		for _, node := range nodesToStop {
-			fmt.Println("-", node.Hostname)
+			fmt.Fprintln(app.Err, "-", node.Hostname)
 		}
 
 		result, err := internal.PromptYesNo("Are you sure you want to stop these Nodes?")
@@ -84,59 +86,103 @@ func (app *App) Stop(args []string) error {
 		}
 
 		if !result {
-			fmt.Println("Aborting...")
+			fmt.Fprintln(app.Err, "Aborting...")
 			return nil
 		}
 	}
 
-	// TODO: cleanup tailout instances that were not last seen recently
+	cloud, err := app.provider()
+	if err != nil {
+		return err
+	}
+
+	instances, err := cloud.List(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	// Keep going on failures and report them per node, so that one stuck
+	// node does not prevent stopping the others.
 	// TODO: warning when stopping a device to which you are connected, propose to disconnect before
+	results := []stoppedNode{}
+	var errs []error
 	for _, node := range nodesToStop {
-		fmt.Println("Stopping", node.Hostname)
+		fmt.Fprintln(app.Err, "Stopping", node.Hostname)
 
-		regionNames, err := internal.GetRegions()
+		result, err := app.stopNode(cloud, control, instances, node, dryRun)
 		if err != nil {
-			return fmt.Errorf("failed to retrieve regions: %w", err)
-		}
-		var region string
-		for _, regionName := range regionNames {
-			if strings.Contains(node.Hostname, regionName) {
-				region = regionName
-			}
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("failed to stop node %s: %w", node.Hostname, err))
 		}
+		results = append(results, result)
+	}
 
-		if region == "" {
-			return errors.New("failed to extract region from node name")
+	if app.structuredOutput() {
+		if err := app.printResult(results); err != nil {
+			return err
 		}
+	}
+	return errors.Join(errs...)
+}
+
+// stopNode terminates the instance of a node and deletes it from the tailnet.
+func (app *App) stopNode(cloud provider.Provider, control controlplane.ControlPlane, instances []provider.Instance, node controlplane.Node, dryRun bool) (stoppedNode, error) {
+	result := stoppedNode{
+		Hostname: node.Hostname,
+	}
 
-		// Create a session to share configuration, and load external configuration.
-		cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	instance, found := findInstance(instances, node)
+	if found {
+		result.Region = instance.Region
+		result.InstanceID = instance.ID
+
+		err := cloud.Terminate(context.TODO(), instance.Region, instance.ID, dryRun)
 		if err != nil {
-			log.Fatalf("unable to load SDK config, %v", err)
+			return result, fmt.Errorf("failed to terminate instance: %w", err)
 		}
+		result.Terminated = true
 
-		ec2Svc := ec2.NewFromConfig(cfg)
+		if !app.structuredOutput() {
+			fmt.Fprintln(app.Out, "Successfully terminated instance", instance.ID, "in", instance.Region)
+		}
+	} else {
+		fmt.Fprintln(app.Err, "No instance found for node", node.Hostname+", it will only be deleted from the tailnet")
+	}
 
-		// Extract the instance ID from the Node name with a regex
+	err := control.DeleteNode(context.TODO(), node.ID)
+	if err != nil {
+		return result, fmt.Errorf("failed to delete node from tailnet: %w", err)
+	}
+	result.Deleted = true
 
-		instanceID := regexp.MustCompile(`i\-[a-z0-9]{17}$`).FindString(node.Hostname)
+	if !app.structuredOutput() {
+		fmt.Fprintln(app.Out, "Successfully deleted node", node.Hostname)
+	}
+	return result, nil
+}
 
-		_, err = ec2Svc.TerminateInstances(context.TODO(), &ec2.TerminateInstancesInput{
-			DryRun:      aws.Bool(dryRun),
-			InstanceIds: []string{instanceID},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to terminate instance: %w", err)
+// findInstance returns the instance running the node. Instances are matched
+// by the tailscale IP recorded in their tags, or by the instance ID in the
+// hostname the node registered with, which survives renames of the node.
+func findInstance(instances []provider.Instance, node controlplane.Node) (provider.Instance, bool) {
+	for _, instance := range instances {
+		for _, address := range node.Addresses {
+			if instance.HasTag(provider.TagTailscaleIP, address) {
+				return instance, true
+			}
 		}
+	}
 
-		fmt.Println("Successfully terminated instance", node.Hostname)
-
-		err = client.Devices().Delete(context.TODO(), node.ID)
-		if err != nil {
-			return fmt.Errorf("failed to delete node from tailnet: %w", err)
+	// The tailnet name of a node gets a "-1" suffix when its hostname is taken.
+	name, _, _ := strings.Cut(node.Name, ".")
+	for _, instance := range instances {
+		nodeName := provider.NodeName(instance.Region, instance.ID)
+		for _, hostname := range []string{node.Hostname, name} {
+			if hostname == nodeName || strings.HasPrefix(hostname, nodeName+"-") {
+				return instance, true
+			}
 		}
-
-		fmt.Println("Successfully deleted node", node.Hostname)
 	}
-	return nil
+
+	return provider.Instance{}, false
 }
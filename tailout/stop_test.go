@@ -0,0 +1,73 @@
+package tailout
+
+import (
+	"testing"
+
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+)
+
+func TestStop(t *testing.T) {
+	app, cloud, control := newFakeApp()
+	for range 2 {
+		if err := app.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A node whose instance is already gone is only deleted from the tailnet.
+	control.nodes = append(control.nodes, controlplane.Node{
+		ID:       "n-gone",
+		Hostname: provider.NodeName("fake-2", "i-gone"),
+		Tags:     []string{"tag:tailout"},
+	})
+
+	stopped := provider.NodeName("fake-1", "i-1")
+	if err := app.Stop([]string{stopped, provider.NodeName("fake-2", "i-gone")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cloud.terminated) != 1 || cloud.terminated[0] != "i-1" {
+		t.Errorf("terminated %v, want [i-1]", cloud.terminated)
+	}
+	if len(control.nodes) != 1 || control.nodes[0].Hostname != provider.NodeName("fake-1", "i-2") {
+		t.Errorf("nodes left %v, want only the second node", control.nodes)
+	}
+
+	app.Config.Stop.All = true
+	if err := app.Stop(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(cloud.instances) != 0 || len(control.nodes) != 0 {
+		t.Errorf("instances %v and nodes %v left after stopping all", cloud.instances, control.nodes)
+	}
+}
+
+func TestFindInstance(t *testing.T) {
+	instances := []provider.Instance{
+		{ID: "i-1", Region: "eu-west-3", Tags: map[string]string{provider.TagTailscaleIP: "100.64.0.1"}},
+		{ID: "i-12", Region: "eu-west-3"},
+		{ID: "42", Region: "fsn1", Tags: map[string]string{"tailout_tailscale-ip": "100_64_0_3"}},
+	}
+	tests := []struct {
+		name string
+		node controlplane.Node
+		want string
+	}{
+		{"tailscale IP", controlplane.Node{Hostname: "renamed", Addresses: []string{"100.64.0.1"}}, "i-1"},
+		{"sanitized tailscale IP", controlplane.Node{Hostname: "renamed", Addresses: []string{"fd7a::3", "100.64.0.3"}}, "42"},
+		{"hostname", controlplane.Node{Hostname: "tailout-eu-west-3-i-12"}, "i-12"},
+		{"draining hostname", controlplane.Node{Hostname: "tailout-eu-west-3-i-12-draining"}, "i-12"},
+		{"taken hostname", controlplane.Node{Hostname: "laptop", Name: "tailout-eu-west-3-i-12-1.tailnet.ts.net"}, "i-12"},
+		{"instance ID prefix", controlplane.Node{Hostname: "tailout-eu-west-3-i-123"}, ""},
+		{"other region", controlplane.Node{Hostname: "tailout-us-east-1-i-12"}, ""},
+		{"not a tailout node", controlplane.Node{Hostname: "laptop", Addresses: []string{"100.64.0.9"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, found := findInstance(instances, tt.node)
+			if found != (tt.want != "") || instance.ID != tt.want {
+				t.Errorf("findInstance() = %q, %v, want %q", instance.ID, found, tt.want)
+			}
+		})
+	}
+}
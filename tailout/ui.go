@@ -1,15 +1,14 @@
 package tailout
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"net/url"
 	"time"
 
 	"github.com/cterence/tailout/internal"
 	"github.com/cterence/tailout/internal/views"
-	tsapi "tailscale.com/client/tailscale/v2"
 
 	"github.com/a-h/templ"
 )
@@ -18,15 +17,34 @@ func (app *App) UI(args []string) error {
 	indexComponent := views.Index()
 	app.Config.NonInteractive = true
 
-	baseURL, err := url.Parse(app.Config.Tailscale.BaseURL)
+	control, err := app.controlPlane()
 	if err != nil {
-		return fmt.Errorf("failed to parse base URL: %w", err)
+		return err
 	}
 
-	client := &tsapi.Client{
-		APIKey:  app.Config.Tailscale.APIKey,
-		Tailnet: app.Config.Tailscale.Tailnet,
-		BaseURL: baseURL,
+	if app.Config.UI.ReapInterval != "" {
+		interval, err := time.ParseDuration(app.Config.UI.ReapInterval)
+		if err != nil {
+			return fmt.Errorf("failed to parse reap interval: %w", err)
+		}
+		if interval <= 0 {
+			return errors.New("reap interval must be positive")
+		}
+
+		// The reaper works on its own copy of the configuration, which the
+		// handlers below modify.
+		reaperConfig := *app.Config
+		reaper := *app
+		reaper.Config = &reaperConfig
+
+		go func() {
+			for range time.Tick(interval) {
+				slog.Info("Reaping expired tailout instances")
+				if err := reaper.Reap(); err != nil {
+					slog.Error("failed to reap instances", "error", err)
+				}
+			}
+		}()
 	}
 
 	http.Handle("/", templ.Handler(indexComponent))
@@ -55,7 +73,7 @@ func (app *App) UI(args []string) error {
 	})
 
 	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		nodes, err := internal.GetActiveNodes(client)
+		nodes, err := internal.GetActiveNodes(control)
 		if err != nil {
 			slog.Error("failed to get active nodes", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
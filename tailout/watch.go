@@ -0,0 +1,207 @@
+package tailout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cterence/tailout/internal"
+	"github.com/cterence/tailout/tailout/controlplane"
+	"github.com/cterence/tailout/tailout/provider"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+)
+
+// watchRetryInterval is how long to wait before trying again to replace an
+// exit node after a failure.
+const watchRetryInterval = 30 * time.Second
+
+// Watch follows the exit node this device is connected to and, when it goes
+// offline or is about to be reclaimed, switches to another online tailout
+// node, or creates a replacement in the same region when there is none left.
+func (app *App) Watch() error {
+	app.Config.NonInteractive = true
+
+	control, err := app.controlPlane()
+	if err != nil {
+		return err
+	}
+
+	for {
+		offline, err := waitForExitNodeDown(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		retryFailover(offline, watchRetryInterval, func(node controlplane.Node) error {
+			return app.failover(control, node, app.Config.Watch.Replace)
+		})
+	}
+}
+
+// retryFailover calls failover with the offline node until it succeeds. The
+// node is kept between attempts since a dead ephemeral node leaves the netmap
+// and would not be reported again by waitForExitNodeDown.
+func retryFailover(offline controlplane.Node, interval time.Duration, failover func(controlplane.Node) error) {
+	for {
+		err := failover(offline)
+		if err == nil {
+			return
+		}
+		slog.Error("failed to replace exit node", "node", offline.Hostname, "error", err)
+		time.Sleep(interval)
+	}
+}
+
+// waitForExitNodeDown watches the IPN bus of the local tailscaled until the
+// exit node in use is offline, draining or gone from the netmap, and returns
+// it.
+func waitForExitNodeDown(ctx context.Context) (controlplane.Node, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var localClient tailscale.LocalClient
+	watcher, err := localClient.WatchIPNBus(ctx, ipn.NotifyInitialPrefs|ipn.NotifyInitialNetMap)
+	if err != nil {
+		return controlplane.Node{}, fmt.Errorf("failed to watch tailscale: %w", err)
+	}
+	defer watcher.Close()
+
+	var exitNodeID tailcfg.StableNodeID
+	exitNode := controlplane.Node{}
+	for {
+		notify, err := watcher.Next()
+		if err != nil {
+			return controlplane.Node{}, fmt.Errorf("failed to watch tailscale: %w", err)
+		}
+
+		if notify.Prefs != nil && notify.Prefs.Valid() {
+			if id := notify.Prefs.ExitNodeID(); id != exitNodeID {
+				exitNodeID = id
+				exitNode = controlplane.Node{}
+				if id == "" {
+					slog.Info("No exit node in use, waiting for one")
+				}
+			}
+		}
+
+		if notify.NetMap == nil || exitNodeID == "" {
+			continue
+		}
+
+		i := slices.IndexFunc(notify.NetMap.Peers, func(peer tailcfg.NodeView) bool {
+			return peer.StableID() == exitNodeID
+		})
+		if i < 0 {
+			// The node was removed from the tailnet, which happens to
+			// ephemeral nodes shortly after their instance is gone.
+			if exitNode.Hostname != "" {
+				slog.Info("Exit node left the tailnet", "node", exitNode.Hostname)
+				return exitNode, nil
+			}
+			continue
+		}
+
+		peer := notify.NetMap.Peers[i]
+		node := controlplane.Node{
+			ID:       string(peer.StableID()),
+			Name:     peer.Name(),
+			Hostname: peer.Hostinfo().Hostname(),
+		}
+		for _, prefix := range peer.Addresses().All() {
+			node.Addresses = append(node.Addresses, prefix.Addr().String())
+		}
+		if exitNode.Hostname != node.Hostname {
+			slog.Info("Watching exit node", "node", node.Hostname)
+		}
+		exitNode = node
+
+		// Peers without a known status are assumed to be online.
+		if online, ok := peer.Online().GetOk(); ok && !online {
+			slog.Info("Exit node went offline", "node", exitNode.Hostname)
+			return exitNode, nil
+		}
+		if draining(exitNode.Hostname) {
+			slog.Info("Exit node is about to be reclaimed", "node", exitNode.Hostname)
+			return exitNode, nil
+		}
+	}
+}
+
+// failover connects to another online tailout node than offline, or creates
+// a new one in the region of offline when there is none and replace is set.
+func (app *App) failover(control controlplane.ControlPlane, offline controlplane.Node, replace bool) error {
+	nodes, err := internal.GetActiveNodes(control)
+	if err != nil {
+		return fmt.Errorf("failed to get active nodes: %w", err)
+	}
+
+	for _, node := range nodes {
+		if !node.Online || draining(node.Hostname) || node.Hostname == offline.Hostname || len(node.Addresses) == 0 {
+			continue
+		}
+		slog.Info("Switching exit node", "from", offline.Hostname, "to", node.Hostname)
+		if err := app.Connect([]string{node.Hostname}); err != nil {
+			return fmt.Errorf("failed to connect to node %s: %w", node.Hostname, err)
+		}
+		return nil
+	}
+
+	if !replace {
+		return errors.New("no other online tailout node found")
+	}
+
+	cloud, err := app.provider()
+	if err != nil {
+		return err
+	}
+
+	instances, err := cloud.List(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	// A reclaimed instance is no longer listed, its region is then read from
+	// the hostname of its node.
+	region := app.Config.Region
+	if instance, found := findInstance(instances, offline); found {
+		region = instance.Region
+	} else {
+		regions, err := cloud.Regions(context.TODO())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve regions: %w", err)
+		}
+		if nodeRegion := hostnameRegion(offline.Hostname, regions); nodeRegion != "" {
+			region = nodeRegion
+		}
+	}
+	if region == "" {
+		return fmt.Errorf("failed to find the instance of node %s, set the region of its replacement with --region", offline.Hostname)
+	}
+
+	slog.Info("No other online tailout node, creating a replacement", "region", region)
+	app.Config.Region = region
+	app.Config.Create.Connect = true
+	if err := app.Create(); err != nil {
+		return fmt.Errorf("failed to create replacement node: %w", err)
+	}
+	return nil
+}
+
+// hostnameRegion returns the region of regions a node hostname was named
+// after by provider.NodeName, or an empty string when there is none.
+func hostnameRegion(hostname string, regions []string) string {
+	found := ""
+	for _, region := range regions {
+		// Regions may be prefixes of others, such as a zone and its region.
+		if strings.HasPrefix(hostname, provider.NodeName(region, "")) && len(region) > len(found) {
+			found = region
+		}
+	}
+	return found
+}
@@ -0,0 +1,49 @@
+package tailout
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cterence/tailout/tailout/controlplane"
+)
+
+func TestHostnameRegion(t *testing.T) {
+	regions := []string{"us-east-1", "europe-west1", "europe-west1-b"}
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"tailout-us-east-1-i-0123456789abcdef0", "us-east-1"},
+		{"tailout-us-east-1-i-0123456789abcdef0-draining", "us-east-1"},
+		{"tailout-europe-west1-b-42", "europe-west1-b"},
+		{"tailout-europe-west1-42", "europe-west1"},
+		{"tailout-eu-central-1-i-0123", ""},
+		{"laptop", ""},
+	}
+	for _, tt := range tests {
+		if got := hostnameRegion(tt.hostname, regions); got != tt.want {
+			t.Errorf("hostnameRegion(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestRetryFailover(t *testing.T) {
+	offline := controlplane.Node{ID: "n-1", Hostname: "tailout-fake-1-i-1"}
+	var calls []controlplane.Node
+	retryFailover(offline, 0, func(node controlplane.Node) error {
+		calls = append(calls, node)
+		if len(calls) == 1 {
+			return errors.New("no capacity")
+		}
+		return nil
+	})
+
+	if len(calls) != 2 {
+		t.Fatalf("failover called %d times, want 2", len(calls))
+	}
+	for i, node := range calls {
+		if node.ID != offline.ID || node.Hostname != offline.Hostname {
+			t.Errorf("call %d got node %+v, want %+v", i, node, offline)
+		}
+	}
+}